@@ -14,19 +14,19 @@ import (
 )
 
 func GetInitializeAction(ctx context.Context, ag *agent.Agent) (*http.Response, error) {
-	req, err := ag.GET("/initialize")
+	req, err := RouteGetInitialize.NewRequest(ag, nil)
 	if err != nil {
 		return nil, err
 	}
-	return ag.Do(ctx, req)
+	return RouteGetInitialize.Do(ctx, ag, req)
 }
 
 func GetLoginAction(ctx context.Context, ag *agent.Agent) (*http.Response, error) {
-	req, err := ag.GET("/login")
+	req, err := RouteGetLogin.NewRequest(ag, nil)
 	if err != nil {
 		return nil, err
 	}
-	return ag.Do(ctx, req)
+	return RouteGetLogin.Do(ctx, ag, req)
 }
 
 func PostLoginAction(ctx context.Context, ag *agent.Agent, accountName string, password string) (*http.Response, error) {
@@ -34,22 +34,22 @@ func PostLoginAction(ctx context.Context, ag *agent.Agent, accountName string, p
 	values.Add("account_name", accountName)
 	values.Add("password", password)
 
-	req, err := ag.POST("/login", strings.NewReader(values.Encode()))
+	req, err := RoutePostLogin.NewRequest(ag, strings.NewReader(values.Encode()))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	return ag.Do(ctx, req)
+	return RoutePostLogin.Do(ctx, ag, req)
 }
 
 func GetRootAction(ctx context.Context, ag *agent.Agent) (*http.Response, error) {
-	req, err := ag.GET("/")
+	req, err := RouteGetRoot.NewRequest(ag, nil)
 	if err != nil {
 		return nil, err
 	}
-	return ag.Do(ctx, req)
+	return RouteGetRoot.Do(ctx, ag, req)
 }
 
 func PostRootAction(ctx context.Context, ag *agent.Agent, post *Post, csrfToken string) (*http.Response, error) {
@@ -78,12 +78,52 @@ func PostRootAction(ctx context.Context, ag *agent.Agent, post *Post, csrfToken
 
 	form.Close()
 
-	req, err := ag.POST("/", body)
+	req, err := RoutePostRoot.NewRequest(ag, body)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Add("Content-Type", form.FormDataContentType())
 
-	return ag.Do(ctx, req)
+	return RoutePostRoot.Do(ctx, ag, req)
+}
+
+func GetPostAction(ctx context.Context, ag *agent.Agent, postID int) (*http.Response, error) {
+	req, err := RouteGetPost.NewRequest(ag, nil, postID)
+	if err != nil {
+		return nil, err
+	}
+	return RouteGetPost.Do(ctx, ag, req)
+}
+
+func GetAccountAction(ctx context.Context, ag *agent.Agent, accountName string) (*http.Response, error) {
+	req, err := RouteGetUser.NewRequest(ag, nil, accountName)
+	if err != nil {
+		return nil, err
+	}
+	return RouteGetUser.Do(ctx, ag, req)
+}
+
+func PostCommentAction(ctx context.Context, ag *agent.Agent, postID int, comment string, csrfToken string) (*http.Response, error) {
+	values := url.Values{}
+	values.Add("post_id", fmt.Sprint(postID))
+	values.Add("comment", comment)
+	values.Add("csrf_token", csrfToken)
+
+	req, err := RoutePostComment.NewRequest(ag, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return RoutePostComment.Do(ctx, ag, req)
+}
+
+func GetLogoutAction(ctx context.Context, ag *agent.Agent) (*http.Response, error) {
+	req, err := RouteGetLogout.NewRequest(ag, nil)
+	if err != nil {
+		return nil, err
+	}
+	return RouteGetLogout.Do(ctx, ag, req)
 }
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/isucon/isucandar"
+)
+
+// LoadOpenModel starts sessions at Option.ArrivalRate per second regardless of
+// their completion. A worker is picked in proportion to its parallelism, and
+// at most Option.MaxInFlight sessions run at once; up to Option.MaxQueued
+// others wait in a queue and further arrivals are dropped.
+func (s *Scenario) LoadOpenModel(ctx context.Context, step *isucandar.BenchmarkStep, config ScenarioConfig) error {
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	maxInFlight := s.Option.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlight
+	}
+	maxQueued := s.Option.MaxQueued
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+
+	slots := make(chan struct{}, maxInFlight)
+	admitted := make(chan struct{}, maxInFlight+maxQueued)
+
+	remaining := make([]int32, len(config.Workers))
+	for i, w := range config.Workers {
+		remaining[i] = w.LoopCount
+		if w.LoopCount == 0 {
+			remaining[i] = -1
+		}
+	}
+
+	interval := time.Duration(float64(time.Second) / s.Option.ArrivalRate)
+	startedAt := time.Now()
+
+	for i := 0; ; i++ {
+		arrivedAt := startedAt.Add(time.Duration(i) * interval)
+
+		timer := time.NewTimer(time.Until(arrivedAt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		index := pickArrivalWorker(config.Workers, remaining)
+		if index < 0 {
+			return nil
+		}
+		workerConfig := config.Workers[index]
+
+		s.Arrivals.Arrive()
+		select {
+		case admitted <- struct{}{}:
+		default:
+			s.Arrivals.Drop()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-admitted }()
+
+			select {
+			case <-ctx.Done():
+				s.Arrivals.Abandon()
+				return
+			case slots <- struct{}{}:
+			}
+			defer func() { <-slots }()
+
+			a := &arrival{arrivedAt: arrivedAt, metrics: &s.Arrivals}
+			s.Arrivals.Run()
+			defer a.finish()
+
+			Flows[workerConfig.PickFlow()](s, workerConfig.WithThinkTime(withArrival(ctx, a)), step)
+		}()
+	}
+}
+
+func pickArrivalWorker(workers []WorkerConfig, remaining []int32) int {
+	total := 0
+	for i, w := range workers {
+		if remaining[i] != 0 {
+			total += int(w.Parallelism)
+		}
+	}
+	if total <= 0 {
+		return -1
+	}
+
+	n := rand.Intn(total)
+	for i, w := range workers {
+		if remaining[i] == 0 {
+			continue
+		}
+		if n < int(w.Parallelism) {
+			if remaining[i] > 0 {
+				remaining[i]--
+			}
+			return i
+		}
+		n -= int(w.Parallelism)
+	}
+
+	return -1
+}
+
+// arrival is a session of the open model. Its queueing delay lasts until the
+// flow sends the first request, including the time spent leasing users.
+type arrival struct {
+	once      sync.Once
+	arrivedAt time.Time
+	metrics   *arrivalMetrics
+}
+
+type arrivalKey struct{}
+
+func withArrival(ctx context.Context, a *arrival) context.Context {
+	return context.WithValue(ctx, arrivalKey{}, a)
+}
+
+// markFlowStarted records the queueing delay of the arrival running with ctx.
+func markFlowStarted(ctx context.Context) {
+	a, ok := ctx.Value(arrivalKey{}).(*arrival)
+	if !ok {
+		return
+	}
+	a.once.Do(func() {
+		a.metrics.Start(time.Since(a.arrivedAt))
+	})
+}
+
+func (a *arrival) finish() {
+	a.once.Do(func() {
+		// the flow gave up before sending any request.
+		a.metrics.Abandon()
+	})
+	a.metrics.Finish()
+}
+
+type arrivalMetrics struct {
+	mu          sync.Mutex
+	arrivals    int64
+	dropped     int64
+	abandoned   int64
+	inFlight    int64
+	maxInFlight int64
+	delays      []time.Duration
+}
+
+func (m *arrivalMetrics) Arrive() {
+	m.mu.Lock()
+	m.arrivals++
+	m.mu.Unlock()
+}
+
+func (m *arrivalMetrics) Drop() {
+	m.mu.Lock()
+	m.dropped++
+	m.mu.Unlock()
+}
+
+func (m *arrivalMetrics) Abandon() {
+	m.mu.Lock()
+	m.abandoned++
+	m.mu.Unlock()
+}
+
+func (m *arrivalMetrics) Run() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight++
+	if m.inFlight > m.maxInFlight {
+		m.maxInFlight = m.inFlight
+	}
+}
+
+func (m *arrivalMetrics) Start(delay time.Duration) {
+	m.mu.Lock()
+	m.delays = append(m.delays, delay)
+	m.mu.Unlock()
+}
+
+func (m *arrivalMetrics) Finish() {
+	m.mu.Lock()
+	m.inFlight--
+	m.mu.Unlock()
+}
+
+func (m *arrivalMetrics) Arrivals() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.arrivals
+}
+
+func (m *arrivalMetrics) Dropped() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dropped
+}
+
+func (m *arrivalMetrics) Report() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lines := []string{
+		fmt.Sprintf("arrivals=%d started=%d dropped=%d abandoned=%d max-in-flight=%d", m.arrivals, len(m.delays), m.dropped, m.abandoned, m.maxInFlight),
+	}
+	if len(m.delays) == 0 {
+		return lines
+	}
+
+	delays := append([]time.Duration{}, m.delays...)
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	total := time.Duration(0)
+	for _, delay := range delays {
+		total += delay
+	}
+	percentile := func(p int) time.Duration {
+		return delays[(len(delays)-1)*p/100].Round(time.Microsecond)
+	}
+
+	lines = append(lines, fmt.Sprintf(
+		"queueing delay avg=%s p50=%s p90=%s p99=%s max=%s",
+		(total/time.Duration(len(delays))).Round(time.Microsecond), percentile(50), percentile(90), percentile(99), delays[len(delays)-1].Round(time.Microsecond),
+	))
+
+	return lines
+}
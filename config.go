@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+type ScenarioConfig struct {
+	Workers []WorkerConfig `json:"workers"`
+	Journey JourneyConfig  `json:"journey"`
+}
+
+type WorkerConfig struct {
+	Name        string         `json:"name"`
+	Flows       map[string]int `json:"flows"`
+	Parallelism int32          `json:"parallelism"`
+	LoopCount   int32          `json:"loop_count"`
+	ThinkTime   *ThinkTime     `json:"think_time,omitempty"`
+}
+
+// JourneyConfig describes the journey flow as a Markov chain. Transitions maps
+// a state to the weights of the next states. A journey starts at JourneyTop
+// and ends at JourneyLogout or after MaxSteps.
+type JourneyConfig struct {
+	MaxSteps    int                       `json:"max_steps"`
+	Transitions map[string]map[string]int `json:"transitions"`
+}
+
+var (
+	DefaultScenarioConfig = ScenarioConfig{
+		Workers: []WorkerConfig{
+			{Name: "success", Flows: map[string]int{FlowLoginPost: 1}, Parallelism: 4},
+			{Name: "cross-user", Flows: map[string]int{FlowCrossUserSession: 1}, Parallelism: 1},
+			{Name: "banned", Flows: map[string]int{FlowBannedUser: 1}, Parallelism: 1, LoopCount: 20},
+			{Name: "failure", Flows: map[string]int{FlowLoginFailure: 1}, Parallelism: 2, LoopCount: 20},
+			{Name: "ordered", Flows: map[string]int{FlowOrderedIndex: 1}, Parallelism: 2},
+			{Name: "journey", Flows: map[string]int{FlowJourney: 1}, Parallelism: 2},
+			{Name: "anonymous", Flows: map[string]int{FlowAnonymous: 1}, Parallelism: 2},
+			{Name: "forgery", Flows: map[string]int{FlowForgedWrite: 1}, Parallelism: 1, LoopCount: 10},
+		},
+	}
+
+	DefaultJourneyConfig = JourneyConfig{
+		MaxSteps: 20,
+		Transitions: map[string]map[string]int{
+			JourneyTop:     {JourneyTop: 1, JourneyPost: 5, JourneyProfile: 2, JourneyNewPost: 1, JourneyLogout: 1},
+			JourneyPost:    {JourneyTop: 4, JourneyProfile: 2, JourneyComment: 3, JourneyLogout: 1},
+			JourneyProfile: {JourneyTop: 4, JourneyPost: 5, JourneyLogout: 1},
+			JourneyComment: {JourneyTop: 4, JourneyPost: 5, JourneyLogout: 1},
+			JourneyNewPost: {JourneyTop: 5, JourneyProfile: 3, JourneyLogout: 2},
+		},
+	}
+)
+
+func LoadScenarioConfig(jsonFile string) (ScenarioConfig, error) {
+	config := ScenarioConfig{}
+
+	file, err := os.Open(jsonFile)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func (c ScenarioConfig) Validate() error {
+	if len(c.Workers) == 0 {
+		return fmt.Errorf("no workers are defined")
+	}
+
+	for i, w := range c.Workers {
+		if len(w.Flows) == 0 {
+			return fmt.Errorf("workers[%d] %s: no flows are defined", i, w.Name)
+		}
+		for name, weight := range w.Flows {
+			if _, ok := Flows[name]; !ok {
+				return fmt.Errorf("workers[%d] %s: unknown flow %q", i, w.Name, name)
+			}
+			if weight <= 0 {
+				return fmt.Errorf("workers[%d] %s: weight of %s must be positive", i, w.Name, name)
+			}
+		}
+		if w.Parallelism <= 0 {
+			return fmt.Errorf("workers[%d] %s: parallelism must be positive", i, w.Name)
+		}
+		if w.LoopCount < 0 {
+			return fmt.Errorf("workers[%d] %s: loop_count must not be negative", i, w.Name)
+		}
+	}
+
+	if len(c.Journey.Transitions) > 0 {
+		if err := c.Journey.Validate(); err != nil {
+			return fmt.Errorf("journey: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (j JourneyConfig) Validate() error {
+	if j.MaxSteps < 0 {
+		return fmt.Errorf("max_steps must not be negative")
+	}
+	if _, ok := j.Transitions[JourneyTop]; !ok {
+		return fmt.Errorf("no transitions from %s", JourneyTop)
+	}
+
+	for state, next := range j.Transitions {
+		if _, ok := JourneySteps[state]; !ok {
+			return fmt.Errorf("unknown state %q", state)
+		}
+		if state == JourneyLogout {
+			return fmt.Errorf("%s must not have transitions", JourneyLogout)
+		}
+		if len(next) == 0 {
+			return fmt.Errorf("no transitions from %s", state)
+		}
+		for nextState, weight := range next {
+			if _, ok := JourneySteps[nextState]; !ok {
+				return fmt.Errorf("%s: unknown state %q", state, nextState)
+			}
+			if _, ok := j.Transitions[nextState]; !ok && nextState != JourneyLogout {
+				return fmt.Errorf("%s: no transitions from %s", state, nextState)
+			}
+			if weight <= 0 {
+				return fmt.Errorf("%s: weight of %s must be positive", state, nextState)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (j JourneyConfig) Next(state string) string {
+	return pickWeighted(j.Transitions[state])
+}
+
+// WithThinkTime returns ctx overriding the think time of flows when the worker has its own.
+func (w WorkerConfig) WithThinkTime(ctx context.Context) context.Context {
+	if w.ThinkTime == nil {
+		return ctx
+	}
+	return WithThinkTime(ctx, *w.ThinkTime)
+}
+
+func (w WorkerConfig) PickFlow() string {
+	return pickWeighted(w.Flows)
+}
+
+func pickWeighted(weights map[string]int) string {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return ""
+	}
+
+	n := rand.Intn(total)
+	for name, weight := range weights {
+		if n < weight {
+			return name
+		}
+		n -= weight
+	}
+
+	return ""
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DumpUsersFile    = "users.json"
+	DumpPostsFile    = "posts.json"
+	DumpCommentsFile = "comments.json"
+)
+
+const (
+	DefaultDumpDir = "./dump"
+	// mysqldump writes TIMESTAMP columns in UTC unless --skip-tz-utc is given.
+	DefaultDumpTimeZone = "UTC"
+)
+
+var (
+	dumpColumns = map[string][]string{
+		"users":    {"id", "account_name", "passhash", "authority", "del_flg", "created_at"},
+		"posts":    {"id", "user_id", "mime", "imgdata", "body", "created_at"},
+		"comments": {"id", "post_id", "user_id", "comment", "created_at"},
+	}
+)
+
+type sqlRow map[string]*sqlValue
+
+type sqlValue struct {
+	Raw    []byte
+	IsNull bool
+}
+
+func (v *sqlValue) String() string {
+	if v == nil || v.IsNull {
+		return ""
+	}
+	return string(v.Raw)
+}
+
+func (v *sqlValue) Int() (int, error) {
+	return strconv.Atoi(v.String())
+}
+
+func (v *sqlValue) Time(loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04:05", v.String(), loc)
+}
+
+func RunDump(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+
+	sqlFile := flags.String("sql", "", "MySQL dump file of private-isu (required)")
+	outDir := flags.String("out", DefaultDumpDir, "Output directory of JSON dumps")
+	timeZone := flags.String("time-zone", DefaultDumpTimeZone, "Time zone of TIMESTAMP columns in the dump")
+	flags.Parse(args)
+
+	if *sqlFile == "" {
+		flags.Usage()
+		return errors.New("--sql is required")
+	}
+
+	loc, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(*sqlFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := []*User{}
+	posts := []*Post{}
+	comments := []*Comment{}
+
+	reader := bufio.NewReaderSize(file, 1<<20)
+	for {
+		table, rows, err := readInsertStatement(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			switch table {
+			case "users":
+				user, err := userFromRow(row, loc)
+				if err != nil {
+					return err
+				}
+				users = append(users, user)
+			case "posts":
+				post, err := postFromRow(row, loc)
+				if err != nil {
+					return err
+				}
+				posts = append(posts, post)
+			case "comments":
+				comment, err := commentFromRow(row, loc)
+				if err != nil {
+					return err
+				}
+				comments = append(comments, comment)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	if err := writeJSON(filepath.Join(*outDir, DumpUsersFile), users); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(*outDir, DumpPostsFile), posts); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(*outDir, DumpCommentsFile), comments); err != nil {
+		return err
+	}
+
+	AdminLogger.Printf("dumped users: %d, posts: %d, comments: %d", len(users), len(posts), len(comments))
+
+	return nil
+}
+
+func writeJSON(jsonFile string, v interface{}) error {
+	file, err := os.Create(jsonFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(v)
+}
+
+func userFromRow(row sqlRow, loc *time.Location) (*User, error) {
+	id, err := row["id"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("users.id: %w", err)
+	}
+	authority, err := row["authority"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("users.authority: %w", err)
+	}
+	deleteFlag, err := row["del_flg"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("users.del_flg: %w", err)
+	}
+	createdAt, err := row["created_at"].Time(loc)
+	if err != nil {
+		return nil, fmt.Errorf("users.created_at: %w", err)
+	}
+
+	accountName := row["account_name"].String()
+
+	// passhash cannot be reversed; the initial data of private-isu uses
+	// the account name repeated twice as the password.
+	return &User{
+		ID:          id,
+		AccountName: accountName,
+		Password:    accountName + accountName,
+		Authority:   authority,
+		DeleteFlag:  deleteFlag,
+		CreatedAt:   createdAt,
+	}, nil
+}
+
+func postFromRow(row sqlRow, loc *time.Location) (*Post, error) {
+	id, err := row["id"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("posts.id: %w", err)
+	}
+	userID, err := row["user_id"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("posts.user_id: %w", err)
+	}
+	createdAt, err := row["created_at"].Time(loc)
+	if err != nil {
+		return nil, fmt.Errorf("posts.created_at: %w", err)
+	}
+
+	imgdata, ok := row["imgdata"]
+	if !ok || imgdata.IsNull {
+		return nil, fmt.Errorf("posts.imgdata: post %d has no image", id)
+	}
+	hash := md5.Sum(imgdata.Raw)
+
+	return &Post{
+		ID:          id,
+		Mime:        row["mime"].String(),
+		Body:        row["body"].String(),
+		ImgdataHash: hex.EncodeToString(hash[:]),
+		UserID:      userID,
+		CreatedAt:   createdAt,
+	}, nil
+}
+
+func commentFromRow(row sqlRow, loc *time.Location) (*Comment, error) {
+	id, err := row["id"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("comments.id: %w", err)
+	}
+	postID, err := row["post_id"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("comments.post_id: %w", err)
+	}
+	userID, err := row["user_id"].Int()
+	if err != nil {
+		return nil, fmt.Errorf("comments.user_id: %w", err)
+	}
+	createdAt, err := row["created_at"].Time(loc)
+	if err != nil {
+		return nil, fmt.Errorf("comments.created_at: %w", err)
+	}
+
+	return &Comment{
+		ID:        id,
+		Comment:   row["comment"].String(),
+		CreatedAt: createdAt,
+		PostID:    postID,
+		UserID:    userID,
+	}, nil
+}
+
+// readInsertStatement skips everything up to the next INSERT statement and
+// returns the rows of it. Statements for unknown tables return no rows.
+func readInsertStatement(r *bufio.Reader) (string, []sqlRow, error) {
+	p := &sqlParser{r: r}
+	keyword := "INSERT INTO"
+
+	for {
+		if _, err := p.peekNonSpace(); err != nil {
+			return "", nil, err
+		}
+
+		head, err := r.Peek(len(keyword))
+		if err == nil && strings.EqualFold(string(head), keyword) {
+			r.Discard(len(keyword))
+			return p.parseInsert()
+		}
+
+		if _, err := r.ReadString('\n'); err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+type sqlParser struct {
+	r *bufio.Reader
+}
+
+func (p *sqlParser) parseInsert() (string, []sqlRow, error) {
+	table, err := p.readIdentifier()
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns := dumpColumns[table]
+
+	c, err := p.peekNonSpace()
+	if err != nil {
+		return "", nil, err
+	}
+	if c == '(' {
+		p.r.ReadByte()
+		columns = []string{}
+		for {
+			column, err := p.readIdentifier()
+			if err != nil {
+				return "", nil, err
+			}
+			columns = append(columns, column)
+
+			c, err := p.readNonSpace()
+			if err != nil {
+				return "", nil, err
+			}
+			if c == ')' {
+				break
+			}
+			if c != ',' {
+				return "", nil, fmt.Errorf("unexpected %q in column list of %s", c, table)
+			}
+		}
+	}
+
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return "", nil, err
+	}
+
+	rows := []sqlRow{}
+	for {
+		values, err := p.readTuple()
+		if err != nil {
+			return "", nil, err
+		}
+
+		if columns != nil {
+			if len(values) != len(columns) {
+				return "", nil, fmt.Errorf("%s: expected %d columns, but got %d", table, len(columns), len(values))
+			}
+			row := sqlRow{}
+			for i, column := range columns {
+				row[column] = values[i]
+			}
+			rows = append(rows, row)
+		}
+
+		c, err := p.readNonSpace()
+		if err != nil {
+			return "", nil, err
+		}
+		if c == ';' {
+			break
+		}
+		if c != ',' {
+			return "", nil, fmt.Errorf("unexpected %q after values of %s", c, table)
+		}
+	}
+
+	return table, rows, nil
+}
+
+func (p *sqlParser) peekNonSpace() (byte, error) {
+	for {
+		c, err := p.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !isSQLSpace(c) {
+			return c, p.r.UnreadByte()
+		}
+	}
+}
+
+func (p *sqlParser) readNonSpace() (byte, error) {
+	if _, err := p.peekNonSpace(); err != nil {
+		return 0, err
+	}
+	return p.r.ReadByte()
+}
+
+func (p *sqlParser) readWord() (string, error) {
+	if _, err := p.peekNonSpace(); err != nil {
+		return "", err
+	}
+
+	word := []byte{}
+	for {
+		c, err := p.r.ReadByte()
+		if err == io.EOF {
+			return string(word), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if isSQLSpace(c) || strings.IndexByte("(),;", c) >= 0 {
+			return string(word), p.r.UnreadByte()
+		}
+		word = append(word, c)
+	}
+}
+
+func (p *sqlParser) readIdentifier() (string, error) {
+	c, err := p.peekNonSpace()
+	if err != nil {
+		return "", err
+	}
+	if c != '`' {
+		return p.readWord()
+	}
+
+	p.r.ReadByte()
+	name, err := p.r.ReadString('`')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(name, "`"), nil
+}
+
+func (p *sqlParser) expectKeyword(keyword string) error {
+	word, err := p.readWord()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(word, keyword) {
+		return fmt.Errorf("expected %s, but got %q", keyword, word)
+	}
+	return nil
+}
+
+func (p *sqlParser) readTuple() ([]*sqlValue, error) {
+	c, err := p.readNonSpace()
+	if err != nil {
+		return nil, err
+	}
+	if c != '(' {
+		return nil, fmt.Errorf("unexpected %q at start of values", c)
+	}
+
+	values := []*sqlValue{}
+	for {
+		value, err := p.readValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		c, err := p.readNonSpace()
+		if err != nil {
+			return nil, err
+		}
+		if c == ')' {
+			return values, nil
+		}
+		if c != ',' {
+			return nil, fmt.Errorf("unexpected %q in values", c)
+		}
+	}
+}
+
+func (p *sqlParser) readValue() (*sqlValue, error) {
+	c, err := p.peekNonSpace()
+	if err != nil {
+		return nil, err
+	}
+	if c == '\'' {
+		p.r.ReadByte()
+		return p.readQuoted()
+	}
+
+	word, err := p.readWord()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.EqualFold(word, "NULL"):
+		return &sqlValue{IsNull: true}, nil
+	case strings.EqualFold(word, "_binary"):
+		if c, err := p.readNonSpace(); err != nil {
+			return nil, err
+		} else if c != '\'' {
+			return nil, fmt.Errorf("unexpected %q after _binary", c)
+		}
+		return p.readQuoted()
+	case strings.HasPrefix(word, "0x") || strings.HasPrefix(word, "0X"):
+		raw, err := hex.DecodeString(word[2:])
+		if err != nil {
+			return nil, err
+		}
+		return &sqlValue{Raw: raw}, nil
+	}
+
+	return &sqlValue{Raw: []byte(word)}, nil
+}
+
+func (p *sqlParser) readQuoted() (*sqlValue, error) {
+	raw := []byte{}
+	for {
+		c, err := p.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch c {
+		case '\\':
+			escaped, err := p.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			raw = append(raw, unescapeSQL(escaped))
+		case '\'':
+			next, err := p.r.ReadByte()
+			if err == nil && next == '\'' {
+				raw = append(raw, '\'')
+				continue
+			}
+			if err == nil {
+				p.r.UnreadByte()
+			}
+			return &sqlValue{Raw: raw}, nil
+		default:
+			raw = append(raw, c)
+		}
+	}
+}
+
+func unescapeSQL(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 26
+	}
+	return c
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadInsertStatement(t *testing.T) {
+	long := strings.Repeat("0123456789", 10)
+
+	testCases := []struct {
+		name     string
+		sql      string
+		table    string
+		expected []map[string]*sqlValue
+	}{
+		{
+			name:  "escaped quotes",
+			sql:   `INSERT INTO ` + "`comments`" + ` VALUES (1,2,3,'it\'s ''quoted'' \\ \"x\"\n','2016-01-01 00:00:00');`,
+			table: "comments",
+			expected: []map[string]*sqlValue{
+				{"id": raw("1"), "post_id": raw("2"), "user_id": raw("3"), "comment": raw(`it's 'quoted' \ "x"` + "\n"), "created_at": raw("2016-01-01 00:00:00")},
+			},
+		},
+		{
+			name:  "null",
+			sql:   "INSERT INTO `users` VALUES (1,'mary',NULL,0,null,'2016-01-01 00:00:00');",
+			table: "users",
+			expected: []map[string]*sqlValue{
+				{"id": raw("1"), "account_name": raw("mary"), "passhash": null(), "authority": raw("0"), "del_flg": null(), "created_at": raw("2016-01-01 00:00:00")},
+			},
+		},
+		{
+			name:  "multiple rows",
+			sql:   "INSERT INTO `comments` (`id`,`comment`) VALUES (1,'a'),(2,'b'), (3,'c');",
+			table: "comments",
+			expected: []map[string]*sqlValue{
+				{"id": raw("1"), "comment": raw("a")},
+				{"id": raw("2"), "comment": raw("b")},
+				{"id": raw("3"), "comment": raw("c")},
+			},
+		},
+		{
+			name:  "across lines",
+			sql:   "-- MySQL dump\n/*!40101 SET NAMES utf8mb4 */;\n\nINSERT INTO `comments`\n  (`id`, `comment`)\nVALUES\n  (1, 'first\nline'),\n  (2, '(,);');\n",
+			table: "comments",
+			expected: []map[string]*sqlValue{
+				{"id": raw("1"), "comment": raw("first\nline")},
+				{"id": raw("2"), "comment": raw("(,);")},
+			},
+		},
+		{
+			name:  "across buffer",
+			sql:   "INSERT INTO `comments` (`id`,`comment`) VALUES (1,'" + long + "'),(2,'" + long + "\\'');",
+			table: "comments",
+			expected: []map[string]*sqlValue{
+				{"id": raw("1"), "comment": raw(long)},
+				{"id": raw("2"), "comment": raw(long + "'")},
+			},
+		},
+		{
+			name:  "binary",
+			sql:   "INSERT INTO `posts` (`id`,`imgdata`,`body`) VALUES (1,0x89504E47,_binary 'a\\0b');",
+			table: "posts",
+			expected: []map[string]*sqlValue{
+				{"id": raw("1"), "imgdata": raw("\x89PNG"), "body": raw("a\x00b")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the smallest buffer makes values cross buffer boundaries.
+			r := bufio.NewReaderSize(strings.NewReader(tc.sql), 16)
+
+			table, rows, err := readInsertStatement(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table != tc.table {
+				t.Errorf("table, expected(%s) != actual(%s)", tc.table, table)
+			}
+			if len(rows) != len(tc.expected) {
+				t.Fatalf("rows, expected(%d) != actual(%d)", len(tc.expected), len(rows))
+			}
+			for i, expected := range tc.expected {
+				if len(rows[i]) != len(expected) {
+					t.Errorf("row %d, expected(%d columns) != actual(%d columns)", i, len(expected), len(rows[i]))
+				}
+				for column, value := range expected {
+					actual, ok := rows[i][column]
+					if !ok {
+						t.Errorf("row %d, %s is missing", i, column)
+						continue
+					}
+					if actual.IsNull != value.IsNull || string(actual.Raw) != string(value.Raw) {
+						t.Errorf("row %d, %s, expected(%q) != actual(%q)", i, column, value.Raw, actual.Raw)
+					}
+				}
+			}
+
+			if _, _, err := readInsertStatement(r); err != io.EOF {
+				t.Errorf("expected EOF after the statement, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadInsertStatementSequence(t *testing.T) {
+	sql := "INSERT INTO `users` (`id`) VALUES (1);\nUNLOCK TABLES;\nINSERT INTO `posts` (`id`) VALUES (2),(3);\n"
+	r := bufio.NewReader(strings.NewReader(sql))
+
+	for _, expected := range []struct {
+		table string
+		rows  int
+	}{{"users", 1}, {"posts", 2}} {
+		table, rows, err := readInsertStatement(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if table != expected.table || len(rows) != expected.rows {
+			t.Errorf("expected(%s %d rows) != actual(%s %d rows)", expected.table, expected.rows, table, len(rows))
+		}
+	}
+}
+
+func TestReadInsertStatementInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		sql  string
+	}{
+		{name: "unterminated string", sql: "INSERT INTO `comments` (`id`,`comment`) VALUES (1,'abc"},
+		{name: "column count", sql: "INSERT INTO `comments` (`id`,`comment`) VALUES (1);"},
+		{name: "missing VALUES", sql: "INSERT INTO `comments` (`id`) (1);"},
+		{name: "missing separator", sql: "INSERT INTO `comments` (`id`) VALUES (1) (2);"},
+		{name: "invalid hex", sql: "INSERT INTO `posts` (`id`) VALUES (0xZZ);"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := readInsertStatement(bufio.NewReader(strings.NewReader(tc.sql))); err == nil {
+				t.Error("invalid statement is accepted")
+			}
+		})
+	}
+}
+
+func TestPostFromRow(t *testing.T) {
+	row := sqlRow{"id": raw("1"), "user_id": raw("2"), "mime": raw("image/png"), "imgdata": raw("\x89PNG"), "body": raw("body"), "created_at": raw("2016-01-02 03:04:05")}
+
+	post, err := postFromRow(row, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC); !post.CreatedAt.Equal(expected) {
+		t.Errorf("created_at, expected(%s) != actual(%s)", expected, post.CreatedAt)
+	}
+
+	delete(row, "imgdata")
+	if _, err := postFromRow(row, time.UTC); err == nil {
+		t.Error("post without imgdata is accepted")
+	}
+}
+
+func raw(value string) *sqlValue {
+	return &sqlValue{Raw: []byte(value)}
+}
+
+func null() *sqlValue {
+	return &sqlValue{IsNull: true}
+}
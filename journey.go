@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/isucon/isucandar"
+	"github.com/isucon/isucandar/failure"
+)
+
+const (
+	JourneyTop     = "top"
+	JourneyPost    = "post"
+	JourneyProfile = "profile"
+	JourneyComment = "comment"
+	JourneyNewPost = "new-post"
+	JourneyLogout  = "logout"
+)
+
+var (
+	JourneySteps = map[string]func(*Scenario, context.Context, *isucandar.BenchmarkStep, *Journey) bool{
+		JourneyTop:     (*Scenario).JourneyTopStep,
+		JourneyPost:    (*Scenario).JourneyPostStep,
+		JourneyProfile: (*Scenario).JourneyProfileStep,
+		JourneyComment: (*Scenario).JourneyCommentStep,
+		JourneyNewPost: (*Scenario).JourneyNewPostStep,
+		JourneyLogout:  (*Scenario).JourneyLogoutStep,
+	}
+)
+
+// Journey is the browsing state of a session walking through JourneyConfig.
+type Journey struct {
+	User *User
+
+	// posts listed on the last visited top or profile page.
+	postIDs []int
+	// the last visited post.
+	post *Post
+}
+
+func (s *Scenario) journeyConfig() JourneyConfig {
+	config := s.Config.Journey
+	if len(config.Transitions) == 0 {
+		config = DefaultJourneyConfig
+	}
+	if config.MaxSteps == 0 {
+		config.MaxSteps = DefaultJourneyConfig.MaxSteps
+	}
+	return config
+}
+
+func (s *Scenario) JourneyFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	user, ok := s.Users.Lease(ctx, IsActiveUser)
+	if !ok {
+		return
+	}
+	defer s.Users.Release(user)
+
+	loggedIn := false
+	if user.IsLoggedIn() {
+		loggedIn = s.CheckSession(ctx, step, user)
+	} else {
+		loggedIn = s.LoginSuccess(ctx, step, user)
+	}
+	if !loggedIn {
+		user.ClearAgent()
+		return
+	}
+
+	config := s.journeyConfig()
+	journey := &Journey{User: user}
+
+	state := JourneyTop
+	for i := 0; i < config.MaxSteps; i++ {
+		if !s.Think(ctx) {
+			user.ClearAgent()
+			return
+		}
+
+		if !JourneySteps[state](s, ctx, step, journey) {
+			user.ClearAgent()
+			return
+		}
+		if state == JourneyLogout {
+			return
+		}
+
+		state = config.Next(state)
+	}
+
+	if !s.keepSession(user) {
+		user.ClearAgent()
+	}
+}
+
+func (s *Scenario) JourneyTopStep(ctx context.Context, step *isucandar.BenchmarkStep, journey *Journey) bool {
+	ag, err := journey.User.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	res, err := GetRootAction(ctx, ag)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer res.Body.Close()
+
+	validation := RouteGetRoot.Validate(
+		res,
+		WithLoggedInUser(journey.User),
+		WithCSRFToken(journey.User),
+		WithIndexPosts(&s.Users, &s.Posts),
+		WithPostIDs(&journey.postIDs),
+	)
+	validation.Add(step)
+
+	if validation.IsEmpty() {
+		step.AddScore(RouteGetRoot.Score)
+		return true
+	}
+	return false
+}
+
+func (s *Scenario) JourneyPostStep(ctx context.Context, step *isucandar.BenchmarkStep, journey *Journey) bool {
+	post, author, ok := s.pickListedPost(journey.postIDs)
+	if !ok {
+		return true
+	}
+
+	ag, err := journey.User.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	// comments tracked before the request must be displayed.
+	comments := post.Comments()
+
+	res, err := GetPostAction(ctx, ag, post.ID)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer res.Body.Close()
+
+	validation := RouteGetPost.Validate(res, WithPost(post, author, comments...), WithCSRFToken(journey.User))
+	validation.Add(step)
+
+	if validation.IsEmpty() {
+		step.AddScore(RouteGetPost.Score)
+		journey.post = post
+		return true
+	}
+	return false
+}
+
+func (s *Scenario) JourneyProfileStep(ctx context.Context, step *isucandar.BenchmarkStep, journey *Journey) bool {
+	user := journey.User
+	if journey.post != nil {
+		if author, ok := s.Users.Get(journey.post.UserID); ok {
+			user = author
+		}
+	}
+
+	ag, err := journey.User.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	res, err := GetAccountAction(ctx, ag, user.AccountName)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer res.Body.Close()
+
+	validation := RouteGetUser.Validate(res, WithUserPage(user), WithPostIDs(&journey.postIDs))
+	validation.Add(step)
+
+	if validation.IsEmpty() {
+		step.AddScore(RouteGetUser.Score)
+		return true
+	}
+	return false
+}
+
+func (s *Scenario) JourneyCommentStep(ctx context.Context, step *isucandar.BenchmarkStep, journey *Journey) bool {
+	post := journey.post
+	if post == nil || journey.User.GetCSRFToken() == "" {
+		return true
+	}
+
+	ag, err := journey.User.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	comment := &Comment{
+		Comment: randomText(),
+		PostID:  post.ID,
+		UserID:  journey.User.ID,
+	}
+
+	// the server stores created_at in seconds at some point between sending
+	// the request and receiving the response.
+	comment.sentAt = time.Now().Truncate(time.Second)
+	post.StartComment()
+	res, err := PostCommentAction(ctx, ag, post.ID, comment.Comment, journey.User.GetCSRFToken())
+	comment.CreatedAt = time.Now().Truncate(time.Second)
+	if err != nil {
+		post.FinishComment(comment, false)
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer res.Body.Close()
+
+	validation := RoutePostComment.Validate(res, WithLocation(RouteGetPost.Path(post.ID)))
+	validation.Add(step)
+
+	if !validation.IsEmpty() {
+		post.FinishComment(comment, false)
+		return false
+	}
+
+	post.FinishComment(comment, true)
+	step.AddScore(RoutePostComment.Score)
+
+	return true
+}
+
+func (s *Scenario) JourneyNewPostStep(ctx context.Context, step *isucandar.BenchmarkStep, journey *Journey) bool {
+	return s.PostImage(ctx, step, journey.User)
+}
+
+func (s *Scenario) JourneyLogoutStep(ctx context.Context, step *isucandar.BenchmarkStep, journey *Journey) bool {
+	ag, err := journey.User.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	res, err := GetLogoutAction(ctx, ag)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer res.Body.Close()
+
+	validation := RouteGetLogout.Validate(res, WithLocation("/"))
+	validation.Add(step)
+
+	journey.User.ClearAgent()
+
+	if validation.IsEmpty() {
+		step.AddScore(RouteGetLogout.Score)
+		return true
+	}
+	return false
+}
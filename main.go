@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/isucon/isucandar"
+	"github.com/isucon/isucandar/agent"
 )
 
 var (
@@ -17,23 +18,104 @@ var (
 
 const (
 	DefaultTargetHost               = "localhost:8080"
+	DefaultTargetAssignment         = TargetRoundRobin
 	DefaultRequestTimeout           = 3 * time.Second
 	DefaultinitializeRequestTimeout = 10 * time.Second
 	DefaultExitErrorOnFail          = true
+	DefaultFreshnessGracePeriod     = 2 * time.Second
+	DefaultKeepSessionRate          = 0.0
+	DefaultArrivalRate              = 0.0
+	DefaultMaxInFlight              = 256
+	DefaultMaxQueued                = 1024
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dump":
+			if err := RunDump(os.Args[2:]); err != nil {
+				AdminLogger.Fatal(err)
+			}
+			return
+		case "replay":
+			if err := RunReplay(os.Args[2:]); err != nil {
+				AdminLogger.Fatal(err)
+			}
+			return
+		}
+	}
+
 	var option Option
 
-	flag.StringVar(&option.TargetHost, "target-host", DefaultTargetHost, "Benchmark target host with port")
+	flag.StringVar(&option.TargetHost, "target-host", DefaultTargetHost, "Benchmark target hosts with port, separated by commas")
+	flag.StringVar(&option.TargetScheme, "target-scheme", SchemeHTTP, "Scheme of target hosts: http or https")
+	flag.StringVar(&option.CACert, "ca-cert", "", "PEM file of CA certificates trusted in addition to the system pool")
+	flag.BoolVar(&option.InsecureSkipVerify, "insecure-skip-verify", false, "Skip verification of server certificates")
+	flag.StringVar(&option.ServerName, "server-name", "", "Host header and TLS server name sent to the targets instead of their hosts")
+	flag.BoolVar(&option.DisableHTTP2, "disable-http2", false, "Use HTTP/1.1 even if the target offers HTTP/2 over TLS")
+	flag.IntVar(&option.MaxIdleConnsPerHost, "max-idle-conns-per-host", agent.DefaultConnections, "Idle connections kept per host by each agent")
+	flag.IntVar(&option.MaxConnsPerHost, "max-conns-per-host", 0, "Connections opened per host by each agent at once (0: unlimited)")
+	flag.DurationVar(&option.IdleConnTimeout, "idle-conn-timeout", 0, "Time until an idle connection is closed (0: never)")
+	flag.Float64Var(&option.DisableKeepAliveRate, "disable-keep-alive-rate", 0.0, "Probability that an agent opens a new connection for every request (0.0 - 1.0)")
+	flag.StringVar(&option.TargetAssignment, "target-assignment", DefaultTargetAssignment, "How sessions are spread over target hosts: round-robin or sticky (a user always visits the same host)")
+	flag.StringVar(&option.AssetHost, "asset-host", "", "Host with port serving /image/ and static assets (default: the target host of the session)")
 	flag.DurationVar(&option.RequestTimeout, "request-timeout", DefaultRequestTimeout, "Default request timeout")
 	flag.DurationVar(&option.InitializeRequestTimeout, "initialize-request-timeout", DefaultinitializeRequestTimeout, "Initialize request timeout")
 	flag.BoolVar(&option.ExitErrorOnFail, "exit-error-on-fail", DefaultExitErrorOnFail, "Exit with error if benchmark fails")
+	flag.StringVar(&option.DumpDir, "dump-dir", DefaultDumpDir, "Directory of JSON dumps of initial data")
+	flag.DurationVar(&option.FreshnessGracePeriod, "freshness-grace-period", DefaultFreshnessGracePeriod, "Grace period until a new post must appear in the top page")
+	flag.StringVar(&option.ScenarioConfig, "scenario-config", "", "JSON file describing workers and flows of load (default: built-in mix)")
+	flag.StringVar(&option.TraceFile, "trace", "", "HAR file to record requests and responses into")
+	flag.BoolVar(&option.TraceFailuresOnly, "trace-failures-only", false, "Record only requests which produced a failure")
+	flag.IntVar(&option.TraceMaxEntries, "trace-max-entries", DefaultTraceMaxEntries, "Maximum entries kept for --trace; later ones are dropped (0: unlimited)")
+	flag.Float64Var(&option.KeepSessionRate, "keep-session-rate", DefaultKeepSessionRate, "Probability that a user keeps the session and cached assets for the next visit (0.0 - 1.0)")
+	flag.Float64Var(&option.ArrivalRate, "arrival-rate", DefaultArrivalRate, "Sessions started per second regardless of completion (0: closed loop workers)")
+	flag.IntVar(&option.MaxInFlight, "max-in-flight", DefaultMaxInFlight, "Maximum sessions running at once with --arrival-rate")
+	flag.IntVar(&option.MaxQueued, "max-queued", DefaultMaxQueued, "Maximum sessions waiting to run with --arrival-rate; further arrivals are dropped")
+	flag.Var(&option.ThinkTime, "think-time", "Pause between steps of a flow: none, const:<d>, uniform:<min>-<max> or exp:<mean> (default none)")
 	flag.Parse()
 
+	if len(option.Targets()) == 0 {
+		AdminLogger.Fatalf("--target-host must not be empty")
+	}
+	if err := ValidateTargetAssignment(option.TargetAssignment); err != nil {
+		AdminLogger.Fatalf("--target-assignment: %v", err)
+	}
+	if option.KeepSessionRate < 0 || option.KeepSessionRate > 1 {
+		AdminLogger.Fatalf("--keep-session-rate must be between 0.0 and 1.0: %v", option.KeepSessionRate)
+	}
+	if option.DisableKeepAliveRate < 0 || option.DisableKeepAliveRate > 1 {
+		AdminLogger.Fatalf("--disable-keep-alive-rate must be between 0.0 and 1.0: %v", option.DisableKeepAliveRate)
+	}
+	if option.ArrivalRate < 0 {
+		AdminLogger.Fatalf("--arrival-rate must not be negative: %v", option.ArrivalRate)
+	}
+	if option.MaxInFlight <= 0 {
+		AdminLogger.Fatalf("--max-in-flight must be positive: %v", option.MaxInFlight)
+	}
+	if option.MaxQueued < 0 {
+		AdminLogger.Fatalf("--max-queued must not be negative: %v", option.MaxQueued)
+	}
+
+	option.metrics = NewMetrics()
+	if err := option.SetupTransport(); err != nil {
+		AdminLogger.Fatalf("--target-scheme: %v", err)
+	}
+
+	if option.TraceFile != "" {
+		option.tracer = NewTracer(option.TraceFailuresOnly, DefaultTraceBodyLimit, option.TraceMaxEntries)
+	}
+
 	AdminLogger.Print(option)
 
 	scenario := &Scenario{Option: option}
+	if option.ScenarioConfig != "" {
+		config, err := LoadScenarioConfig(option.ScenarioConfig)
+		if err != nil {
+			AdminLogger.Fatal(err)
+		}
+		scenario.Config = config
+	}
 	benchmark, err := isucandar.NewBenchmark(
 		isucandar.WithoutPanicRecover(),
 		isucandar.WithLoadTimeout(1*time.Minute),
@@ -54,6 +136,31 @@ func main() {
 		AdminLogger.Printf("%+v", err)
 	}
 
+	for _, line := range option.metrics.Routes.Report() {
+		AdminLogger.Print(line)
+	}
+	for _, line := range option.metrics.Targets.Report() {
+		AdminLogger.Print("target " + line)
+	}
+	for _, line := range option.metrics.Connections.Report() {
+		AdminLogger.Print(line)
+	}
+
+	if option.ArrivalRate > 0 {
+		for _, line := range scenario.Arrivals.Report() {
+			AdminLogger.Print(line)
+		}
+	}
+
+	if option.tracer != nil {
+		if err := option.tracer.WriteHAR(option.TraceFile); err != nil {
+			AdminLogger.Print(err)
+		}
+		if dropped := option.tracer.Dropped(); dropped > 0 {
+			AdminLogger.Printf("trace dropped %d entries over --trace-max-entries", dropped)
+		}
+	}
+
 	score := SumScore(result)
 	ContestantLogger.Printf("score: %d", score)
 
@@ -68,6 +175,10 @@ func SumScore(result *isucandar.BenchmarkResult) int64 {
 	score.Set(ScoreGETLogin, 1)
 	score.Set(ScorePOSTLogin, 2)
 	score.Set(ScorePOSTRoot, 5)
+	score.Set(ScoreGETPost, 1)
+	score.Set(ScoreGETUser, 1)
+	score.Set(ScorePOSTComment, 2)
+	score.Set(ScoreGETLogout, 1)
 
 	addition := score.Sum()
 	deduction := len(result.Errors.All())
@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	mockSessionCookie = "isuconp-go.session"
+	mockPostsPerPage  = 20
+)
+
+var (
+	mockAssets = map[string]string{
+		"favicon.ico":       "mock favicon",
+		"js/timeago.min.js": "/* mock timeago */",
+		"js/main.js":        "/* mock main */",
+		"css/style.css":     "/* mock style */",
+	}
+)
+
+type MockOptions struct {
+	// Delay delays responses once StartLoad is called, so that Prepare of the
+	// scenario runs at full speed.
+	Delay        time.Duration
+	WrongOrder   bool
+	BrokenAssets bool
+	IgnoreCSRF   bool
+	// NotInitialized keeps a post and a comment of a previous run over /initialize.
+	NotInitialized bool
+}
+
+type mockPost struct {
+	ID        int
+	UserID    int
+	Mime      string
+	Imgdata   []byte
+	Body      string
+	CreatedAt time.Time
+}
+
+type mockComment struct {
+	ID        int
+	PostID    int
+	UserID    int
+	Comment   string
+	CreatedAt time.Time
+}
+
+type mockSession struct {
+	UserID    int
+	CSRFToken string
+	Flash     string
+}
+
+type MockServer struct {
+	mu sync.RWMutex
+
+	Options MockOptions
+
+	initialUsers    []*User
+	initialPosts    []*mockPost
+	initialComments []*mockComment
+
+	users    map[int]*User
+	posts    []*mockPost
+	comments []*mockComment
+	sessions map[string]*mockSession
+
+	templates *template.Template
+
+	loading int32
+}
+
+type MockFixture struct {
+	Users    []*User
+	Posts    []*Post
+	Comments []*Comment
+	Images   map[int][]byte
+}
+
+// NewMockFixture builds a small initial data set. The last user is banned.
+func NewMockFixture(users, posts, comments int) *MockFixture {
+	f := &MockFixture{Images: map[int][]byte{}}
+	base := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+
+	for i := 1; i <= users; i++ {
+		name := fmt.Sprintf("user%02d", i)
+		user := &User{ID: i, AccountName: name, Password: name + name, CreatedAt: base}
+		if i == users {
+			user.DeleteFlag = 1
+		}
+		f.Users = append(f.Users, user)
+	}
+
+	for i := 1; i <= posts; i++ {
+		img := make([]byte, 64)
+		rand.Read(img)
+		hash := md5.Sum(img)
+
+		f.Images[i] = img
+		f.Posts = append(f.Posts, &Post{
+			ID:          i,
+			Mime:        "image/png",
+			Body:        fmt.Sprintf("post body %d", i),
+			ImgdataHash: hex.EncodeToString(hash[:]),
+			UserID:      (i-1)%users + 1,
+			CreatedAt:   base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	for i := 1; i <= comments; i++ {
+		f.Comments = append(f.Comments, &Comment{
+			ID:        i,
+			Comment:   fmt.Sprintf("comment %d", i),
+			PostID:    (i-1)%posts + 1,
+			UserID:    (i-1)%(users-1) + 1,
+			CreatedAt: base.Add(time.Duration(posts)*time.Minute + time.Duration(i)*time.Second),
+		})
+	}
+
+	return f
+}
+
+func (f *MockFixture) WriteDump(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for file, v := range map[string]interface{}{
+		DumpUsersFile:    f.Users,
+		DumpPostsFile:    f.Posts,
+		DumpCommentsFile: f.Comments,
+	} {
+		if err := writeJSON(filepath.Join(dir, file), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func NewMockServer(f *MockFixture, options MockOptions) *MockServer {
+	s := &MockServer{
+		Options:   options,
+		templates: template.Must(template.New("").Funcs(template.FuncMap{"imageURL": mockImageURL}).Parse(mockTemplates)),
+	}
+
+	for _, user := range f.Users {
+		s.initialUsers = append(s.initialUsers, user)
+	}
+	for _, post := range f.Posts {
+		s.initialPosts = append(s.initialPosts, &mockPost{
+			ID:        post.ID,
+			UserID:    post.UserID,
+			Mime:      post.Mime,
+			Imgdata:   f.Images[post.ID],
+			Body:      post.Body,
+			CreatedAt: post.CreatedAt,
+		})
+	}
+	for _, comment := range f.Comments {
+		s.initialComments = append(s.initialComments, &mockComment{
+			ID:        comment.ID,
+			PostID:    comment.PostID,
+			UserID:    comment.UserID,
+			Comment:   comment.Comment,
+			CreatedAt: comment.CreatedAt,
+		})
+	}
+
+	s.initialize()
+	if options.NotInitialized {
+		// the first post is by an active user, the last one by the banned user.
+		first := s.posts[0]
+		s.posts = append(s.posts, &mockPost{ID: len(s.posts) + 1, UserID: first.UserID, Mime: first.Mime, Imgdata: first.Imgdata, Body: "left over", CreatedAt: time.Now().Truncate(time.Second)})
+		s.comments = append(s.comments, &mockComment{ID: len(s.comments) + 1, PostID: first.ID, UserID: first.UserID, Comment: "left over", CreatedAt: time.Now().Truncate(time.Second)})
+	}
+
+	return s
+}
+
+// Start serves the mock with httptest and overrides the expected asset hashes
+// until the test finishes.
+func (s *MockServer) Start(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	original := assetsMD5
+	t.Cleanup(func() { assetsMD5 = original })
+
+	assetsMD5 = map[string]string{}
+	for path, content := range mockAssets {
+		hash := md5.Sum([]byte(content))
+		assetsMD5[path] = hex.EncodeToString(hash[:])
+	}
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// StartLoad starts delaying responses by Options.Delay.
+func (s *MockServer) StartLoad() {
+	atomic.StoreInt32(&s.loading, 1)
+}
+
+func (s *MockServer) initialize() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = map[int]*User{}
+	for _, user := range s.initialUsers {
+		s.users[user.ID] = user
+	}
+	s.posts = append([]*mockPost{}, s.initialPosts...)
+	s.comments = append([]*mockComment{}, s.initialComments...)
+	s.sessions = map[string]*mockSession{}
+}
+
+func (s *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Options.Delay > 0 && atomic.LoadInt32(&s.loading) != 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.Options.Delay):
+		}
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/initialize":
+		if !s.Options.NotInitialized {
+			s.initialize()
+		}
+		w.WriteHeader(http.StatusOK)
+	case path == "/login" && r.Method == http.MethodGet:
+		s.getLogin(w, r)
+	case path == "/login" && r.Method == http.MethodPost:
+		s.postLogin(w, r)
+	case path == "/logout":
+		s.withSession(w, r, func(session *mockSession, _ *User) {
+			session.UserID = 0
+		})
+		http.Redirect(w, r, "/", http.StatusFound)
+	case path == "/" && r.Method == http.MethodGet:
+		s.getIndex(w, r)
+	case path == "/" && r.Method == http.MethodPost:
+		s.postIndex(w, r)
+	case path == "/comment" && r.Method == http.MethodPost:
+		s.postComment(w, r)
+	case strings.HasPrefix(path, "/posts/"):
+		s.getPost(w, r)
+	case strings.HasPrefix(path, "/@"):
+		s.getUser(w, r)
+	case strings.HasPrefix(path, "/image/"):
+		s.getImage(w, r)
+	default:
+		content, ok := mockAssets[strings.TrimPrefix(path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if s.Options.BrokenAssets {
+			content += "broken"
+		}
+		io.WriteString(w, content)
+	}
+}
+
+func (s *MockServer) withSession(w http.ResponseWriter, r *http.Request, f func(*mockSession, *User)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var session *mockSession
+	if cookie, err := r.Cookie(mockSessionCookie); err == nil {
+		session = s.sessions[cookie.Value]
+	}
+	if session == nil {
+		id := mockRandomString()
+		session = &mockSession{CSRFToken: mockRandomString()}
+		s.sessions[id] = session
+		http.SetCookie(w, &http.Cookie{Name: mockSessionCookie, Value: id, Path: "/"})
+	}
+
+	f(session, s.users[session.UserID])
+}
+
+func (s *MockServer) getLogin(w http.ResponseWriter, r *http.Request) {
+	var flash string
+	var me *User
+	s.withSession(w, r, func(session *mockSession, user *User) {
+		flash, session.Flash = session.Flash, ""
+		me = user
+	})
+
+	if me != nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	s.render(w, "login", map[string]interface{}{"Flash": flash})
+}
+
+func (s *MockServer) postLogin(w http.ResponseWriter, r *http.Request) {
+	accountName := r.FormValue("account_name")
+	password := r.FormValue("password")
+
+	location := "/login"
+	s.withSession(w, r, func(session *mockSession, _ *User) {
+		for _, user := range s.users {
+			if user.AccountName == accountName && user.Password == password && user.DeleteFlag == 0 {
+				session.UserID = user.ID
+				session.CSRFToken = mockRandomString()
+				location = "/"
+				return
+			}
+		}
+		session.Flash = "アカウント名かパスワードが間違っています"
+	})
+
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+func (s *MockServer) getIndex(w http.ResponseWriter, r *http.Request) {
+	var data map[string]interface{}
+	s.withSession(w, r, func(session *mockSession, me *User) {
+		posts := s.visiblePosts(func(*mockPost) bool { return true })
+		data = map[string]interface{}{
+			"Me":        me,
+			"CSRFToken": session.CSRFToken,
+			"Posts":     s.renderPosts(posts, false),
+		}
+	})
+
+	s.render(w, "index", data)
+}
+
+func (s *MockServer) postIndex(w http.ResponseWriter, r *http.Request) {
+	status, location := 0, ""
+
+	s.withSession(w, r, func(session *mockSession, me *User) {
+		if me == nil {
+			status, location = http.StatusFound, "/login"
+			return
+		}
+		if !s.Options.IgnoreCSRF && r.FormValue("csrf_token") != session.CSRFToken {
+			status = http.StatusUnprocessableEntity
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			status, location = http.StatusFound, "/"
+			return
+		}
+		defer file.Close()
+		img, _ := io.ReadAll(file)
+
+		post := &mockPost{
+			ID:        len(s.posts) + 1,
+			UserID:    me.ID,
+			Mime:      header.Header.Get("Content-Type"),
+			Imgdata:   img,
+			Body:      r.FormValue("body"),
+			CreatedAt: time.Now().Truncate(time.Second),
+		}
+		s.posts = append(s.posts, post)
+
+		status, location = http.StatusFound, fmt.Sprintf("/posts/%d", post.ID)
+	})
+
+	if location != "" {
+		http.Redirect(w, r, location, status)
+	} else {
+		w.WriteHeader(status)
+	}
+}
+
+func (s *MockServer) postComment(w http.ResponseWriter, r *http.Request) {
+	status, location := 0, ""
+
+	s.withSession(w, r, func(session *mockSession, me *User) {
+		if me == nil {
+			status, location = http.StatusFound, "/login"
+			return
+		}
+		if !s.Options.IgnoreCSRF && r.FormValue("csrf_token") != session.CSRFToken {
+			status = http.StatusUnprocessableEntity
+			return
+		}
+
+		postID, err := strconv.Atoi(r.FormValue("post_id"))
+		if err != nil {
+			status, location = http.StatusFound, "/"
+			return
+		}
+
+		s.comments = append(s.comments, &mockComment{
+			ID:        len(s.comments) + 1,
+			PostID:    postID,
+			UserID:    me.ID,
+			Comment:   r.FormValue("comment"),
+			CreatedAt: time.Now().Truncate(time.Second),
+		})
+
+		status, location = http.StatusFound, fmt.Sprintf("/posts/%d", postID)
+	})
+
+	if location != "" {
+		http.Redirect(w, r, location, status)
+	} else {
+		w.WriteHeader(status)
+	}
+}
+
+func (s *MockServer) getPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/posts/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var data map[string]interface{}
+	s.withSession(w, r, func(session *mockSession, me *User) {
+		posts := s.visiblePosts(func(p *mockPost) bool { return p.ID == id })
+		if len(posts) == 0 {
+			return
+		}
+		data = map[string]interface{}{
+			"Me":        me,
+			"CSRFToken": session.CSRFToken,
+			"Posts":     s.renderPosts(posts, true),
+		}
+	})
+
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, "post", data)
+}
+
+func (s *MockServer) getUser(w http.ResponseWriter, r *http.Request) {
+	accountName := strings.TrimPrefix(r.URL.Path, "/@")
+
+	var data map[string]interface{}
+	s.withSession(w, r, func(session *mockSession, me *User) {
+		for _, user := range s.users {
+			if user.AccountName == accountName && user.DeleteFlag == 0 {
+				posts := s.visiblePosts(func(p *mockPost) bool { return p.UserID == user.ID })
+				data = map[string]interface{}{
+					"Me":        me,
+					"User":      user,
+					"CSRFToken": session.CSRFToken,
+					"Posts":     s.renderPosts(posts, false),
+				}
+				return
+			}
+		}
+	})
+
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, "user", data)
+}
+
+func (s *MockServer) getImage(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/image/")
+	id, err := strconv.Atoi(strings.TrimSuffix(name, filepath.Ext(name)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, post := range s.posts {
+		if post.ID == id {
+			w.Header().Set("Content-Type", post.Mime)
+			w.Write(post.Imgdata)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// visiblePosts must be called with s.mu held.
+func (s *MockServer) visiblePosts(filter func(*mockPost) bool) []*mockPost {
+	posts := []*mockPost{}
+	for _, post := range s.posts {
+		if user, ok := s.users[post.UserID]; ok && user.DeleteFlag == 0 && filter(post) {
+			posts = append(posts, post)
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		if s.Options.WrongOrder {
+			return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+		}
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+
+	if len(posts) > mockPostsPerPage {
+		posts = posts[:mockPostsPerPage]
+	}
+	return posts
+}
+
+type mockRenderedComment struct {
+	*mockComment
+	User *User
+}
+
+type mockRenderedPost struct {
+	*mockPost
+	User         *User
+	CommentCount int
+	Comments     []mockRenderedComment
+}
+
+// renderPosts must be called with s.mu held.
+func (s *MockServer) renderPosts(posts []*mockPost, allComments bool) []mockRenderedPost {
+	rendered := []mockRenderedPost{}
+	for _, post := range posts {
+		comments := []*mockComment{}
+		for _, comment := range s.comments {
+			if comment.PostID == post.ID {
+				comments = append(comments, comment)
+			}
+		}
+		count := len(comments)
+
+		sort.SliceStable(comments, func(i, j int) bool {
+			return comments[i].CreatedAt.After(comments[j].CreatedAt)
+		})
+		if !allComments && len(comments) > LatestCommentsOnIndex {
+			comments = comments[:LatestCommentsOnIndex]
+		}
+
+		renderedComments := []mockRenderedComment{}
+		for i := len(comments) - 1; i >= 0; i-- {
+			renderedComments = append(renderedComments, mockRenderedComment{mockComment: comments[i], User: s.users[comments[i].UserID]})
+		}
+
+		rendered = append(rendered, mockRenderedPost{
+			mockPost:     post,
+			User:         s.users[post.UserID],
+			CommentCount: count,
+			Comments:     renderedComments,
+		})
+	}
+	return rendered
+}
+
+func (s *MockServer) render(w http.ResponseWriter, name string, data interface{}) {
+	buf := &bytes.Buffer{}
+	if err := s.templates.ExecuteTemplate(buf, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+func mockImageURL(id int, mime string) string {
+	return (&Post{ID: id, Mime: mime}).ImageURL()
+}
+
+func mockRandomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+const mockTemplates = `
+{{ define "header" }}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Iscogram</title>
+<link href="/css/style.css" media="screen" rel="stylesheet" type="text/css">
+<link href="/favicon.ico" rel="icon">
+</head>
+<body>
+<div class="container">
+<div class="header">
+<div class="isu-title"><h1><a href="/">Iscogram</a></h1></div>
+<div class="isu-header-menu">
+{{ if .Me }}
+<div><a href="/@{{ .Me.AccountName }}"><span class="isu-account-name">{{ .Me.AccountName }}</span>さん</a></div>
+<div><a href="/logout">ログアウト</a></div>
+{{ else }}
+<div><a href="/login">ログイン</a></div>
+{{ end }}
+</div>
+</div>
+{{ end }}
+
+{{ define "footer" }}
+</div>
+<script src="/js/timeago.min.js"></script>
+<script src="/js/main.js"></script>
+</body>
+</html>
+{{ end }}
+
+{{ define "login" }}{{ template "header" . }}
+<div class="header">
+<h1>ログイン</h1>
+</div>
+{{ if .Flash }}<div id="notice-message" class="alert alert-danger">{{ .Flash }}</div>{{ end }}
+<div class="submit">
+<form method="post" action="/login">
+<div class="form-account-name"><input type="text" name="account_name"></div>
+<div class="form-password"><input type="password" name="password"></div>
+<div class="form-submit"><input type="submit" name="submit" value="submit"></div>
+</form>
+</div>
+{{ template "footer" . }}{{ end }}
+
+{{ define "index" }}{{ template "header" . }}
+{{ if .Me }}
+<div class="isu-submit">
+<form method="post" action="/" enctype="multipart/form-data">
+<div class="isu-form"><input type="file" name="file" value="file"></div>
+<div class="isu-form"><textarea name="body"></textarea></div>
+<div class="form-submit">
+<input type="hidden" name="csrf_token" value="{{ .CSRFToken }}">
+<input type="submit" name="submit" value="submit">
+</div>
+</form>
+</div>
+{{ end }}
+{{ template "post-list" . }}
+{{ template "footer" . }}{{ end }}
+
+{{ define "post" }}{{ template "header" . }}
+{{ template "post-list" . }}
+{{ template "footer" . }}{{ end }}
+
+{{ define "user" }}{{ template "header" . }}
+<div class="isu-user">
+<div><span class="isu-user-account-name">{{ .User.AccountName }}さん</span>のページ</div>
+</div>
+{{ template "post-list" . }}
+{{ template "footer" . }}{{ end }}
+
+{{ define "post-list" }}
+<div class="isu-posts">
+{{ $me := .Me }}{{ $token := .CSRFToken }}
+{{ range .Posts }}
+<div class="isu-post" id="pid_{{ .ID }}" data-created-at="{{ .CreatedAt.Format "2006-01-02T15:04:05-07:00" }}">
+<div class="isu-post-header">
+<a href="/@{{ .User.AccountName }}" class="isu-post-account-name">{{ .User.AccountName }}</a>
+<a href="/posts/{{ .ID }}" class="isu-post-permalink"><time class="timeago" datetime="{{ .CreatedAt.Format "2006-01-02T15:04:05-07:00" }}"></time></a>
+</div>
+<div class="isu-post-image"><img src="{{ imageURL .ID .Mime }}" class="isu-image"></div>
+<div class="isu-post-text">
+<a href="/@{{ .User.AccountName }}" class="isu-post-account-name">{{ .User.AccountName }}</a>
+{{ .Body }}
+</div>
+<div class="isu-post-comment">
+<div class="isu-post-comment-count">comments: <b>{{ .CommentCount }}</b></div>
+{{ range .Comments }}
+<div class="isu-comment">
+<a href="/@{{ .User.AccountName }}" class="isu-comment-account-name">{{ .User.AccountName }}</a>
+<span class="isu-comment-text">{{ .Comment }}</span>
+</div>
+{{ end }}
+{{ if $me }}
+<div class="isu-comment-form">
+<form method="post" action="/comment">
+<input type="text" name="comment">
+<input type="hidden" name="post_id" value="{{ .ID }}">
+<input type="hidden" name="csrf_token" value="{{ $token }}">
+<input type="submit" name="submit" value="submit">
+</form>
+</div>
+{{ end }}
+</div>
+</div>
+{{ end }}
+</div>
+{{ end }}
+`
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -18,11 +21,150 @@ type User struct {
 	CreatedAt   time.Time `json:"created_at"`
 
 	csrfToken string
-	Agent     *agent.Agent
+	loggedIn  bool
+	Agent     *agent.Agent `json:"-"`
 }
 
 type UserSet struct {
 	Set[*User]
+
+	leaseMu  sync.Mutex
+	leased   map[int]bool
+	kept     map[int]bool
+	released chan struct{}
+}
+
+func IsActiveUser(u *User) bool {
+	return u.DeleteFlag == 0
+}
+
+func IsBannedUser(u *User) bool {
+	return u.DeleteFlag != 0
+}
+
+func IsLoggedOutUser(u *User) bool {
+	return u.DeleteFlag == 0 && !u.IsLoggedIn()
+}
+
+// TryLease checks out a random user matching filter that is not leased by
+// another flow. It returns false without waiting when every such user is busy.
+func (s *UserSet) TryLease(filter func(*User) bool) (*User, bool) {
+	user, _ := s.tryLease(filter)
+	return user, user != nil
+}
+
+// Lease is like TryLease but waits until a matching user is released, as
+// flows change users (e.g. log them out) only while they hold them.
+// It returns false when ctx is done.
+func (s *UserSet) Lease(ctx context.Context, filter func(*User) bool) (*User, bool) {
+	for {
+		user, released := s.tryLease(filter)
+		if user != nil {
+			return user, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-released:
+		}
+	}
+}
+
+func (s *UserSet) tryLease(filter func(*User) bool) (*User, <-chan struct{}) {
+	candidates := s.Filter(func(u *User) bool { return filter == nil || filter(u) })
+
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	if s.leased == nil {
+		s.leased = map[int]bool{}
+	}
+	if s.released == nil {
+		s.released = make(chan struct{})
+	}
+
+	free := make([]*User, 0, len(candidates))
+	for _, user := range candidates {
+		if !s.leased[user.ID] {
+			free = append(free, user)
+		}
+	}
+	if len(free) == 0 {
+		return nil, s.released
+	}
+
+	user := free[rand.Intn(len(free))]
+	s.leased[user.ID] = true
+
+	return user, s.released
+}
+
+// leasePair leases two different users matching filter. Only the first one
+// is waited for: waiting for the second while holding the first may deadlock,
+// so the first is released again when no second user is free, and leasePair
+// returns false once another user is released or ctx is done.
+func (s *UserSet) leasePair(ctx context.Context, filter func(*User) bool) (*User, *User, bool) {
+	first, ok := s.Lease(ctx, filter)
+	if !ok {
+		return nil, nil, false
+	}
+
+	second, ok := s.TryLease(filter)
+	if !ok {
+		released := s.release(first)
+		select {
+		case <-ctx.Done():
+		case <-released:
+		}
+		return nil, nil, false
+	}
+
+	return first, second, true
+}
+
+// KeepSession lets a leased user keep the session after Release while less
+// than limit users do. The session counts until the user is released logged out.
+func (s *UserSet) KeepSession(user *User, limit int) bool {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	if s.kept == nil {
+		s.kept = map[int]bool{}
+	}
+	if s.kept[user.ID] {
+		return true
+	}
+	if len(s.kept) >= limit {
+		return false
+	}
+	s.kept[user.ID] = true
+	return true
+}
+
+func (s *UserSet) Release(user *User) {
+	s.release(user)
+}
+
+// release returns the channel closed by the next release after this one.
+func (s *UserSet) release(user *User) <-chan struct{} {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	if !s.leased[user.ID] {
+		return s.released
+	}
+	delete(s.leased, user.ID)
+	if s.kept[user.ID] && !user.IsLoggedIn() {
+		delete(s.kept, user.ID)
+	}
+
+	if s.released != nil {
+		close(s.released)
+	}
+	s.released = make(chan struct{})
+
+	return s.released
 }
 
 func (m *User) GetID() int {
@@ -51,7 +193,7 @@ func (m *User) GetAgent(o Option) (*agent.Agent, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	a, err := o.NewAgent(false)
+	a, err := o.NewUserAgent(m)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +206,20 @@ func (m *User) ClearAgent() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.Agent = nil
+	m.loggedIn = false
+}
+
+func (m *User) SetLoggedIn(loggedIn bool) {
+	m.mu.Lock()
+	m.loggedIn = loggedIn
+	m.mu.Unlock()
+}
+
+func (m *User) IsLoggedIn() bool {
+	m.mu.RLock()
+	loggedIn := m.loggedIn
+	m.mu.RUnlock()
+	return loggedIn
 }
 
 func (m *User) SetCSRFToken(token string) {
@@ -80,12 +236,18 @@ func (m *User) GetCSRFToken() string {
 }
 
 type Post struct {
+	mu sync.RWMutex
+
 	ID          int       `json:"id"`
 	Mime        string    `json:"mime"`
 	Body        string    `json:"body"`
 	ImgdataHash string    `json:"imgdata_hash"`
 	UserID      int       `json:"user_id"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	comments            []*Comment
+	unconfirmedComments []*Comment
+	pendingComments     int
 }
 
 func (m *Post) GetID() int {
@@ -102,6 +264,62 @@ func (m *Post) GetCreatedAt() time.Time {
 	return m.CreatedAt
 }
 
+func (m *Post) ImageURL() string {
+	ext := ""
+	switch m.Mime {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	case "image/gif":
+		ext = ".gif"
+	}
+	return fmt.Sprintf("/image/%d%s", m.ID, ext)
+}
+
+func (m *Post) AddComment(comment *Comment) {
+	m.mu.Lock()
+	m.comments = append(m.comments, comment)
+	m.mu.Unlock()
+}
+
+func (m *Post) Comments() []*Comment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*Comment{}, m.comments...)
+}
+
+// StartComment marks a comment as in flight until FinishComment is called,
+// because the server may already display it before the response arrives.
+func (m *Post) StartComment() {
+	m.mu.Lock()
+	m.pendingComments++
+	m.mu.Unlock()
+}
+
+// FinishComment tracks the comment. Unless confirmed, the request failed and
+// the comment may or may not have been created.
+func (m *Post) FinishComment(comment *Comment, confirmed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pendingComments--
+	comment.trackedAt = time.Now()
+	if confirmed {
+		m.comments = append(m.comments, comment)
+	} else {
+		m.unconfirmedComments = append(m.unconfirmedComments, comment)
+	}
+}
+
+// UncertainComments returns comments which may be displayed, and the number of
+// comments in flight.
+func (m *Post) UncertainComments() ([]*Comment, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*Comment{}, m.unconfirmedComments...), m.pendingComments
+}
+
 type PostSet struct {
 	Set[*Post]
 }
@@ -112,6 +330,11 @@ type Comment struct {
 	CreatedAt time.Time `json:"created_at"`
 	PostID    int       `json:"post_id"`
 	UserID    int       `json:"user_id"`
+
+	// sentAt is when the request creating the comment was sent; CreatedAt is
+	// when its response arrived. Comments of the dump have no sentAt.
+	sentAt    time.Time
+	trackedAt time.Time
 }
 
 func (m *Comment) GetID() int {
@@ -121,6 +344,15 @@ func (m *Comment) GetID() int {
 	return m.ID
 }
 
+// CreatedAtRange returns the earliest and the latest created_at the server
+// may have stored for the comment.
+func (m *Comment) CreatedAtRange() (time.Time, time.Time) {
+	if m.sentAt.IsZero() {
+		return m.CreatedAt, m.CreatedAt
+	}
+	return m.sentAt, m.CreatedAt
+}
+
 func (m *Comment) GetCreatedAt() time.Time {
 	if m == nil {
 		return time.Unix(0, 0)
@@ -128,6 +360,11 @@ func (m *Comment) GetCreatedAt() time.Time {
 	return m.CreatedAt
 }
 
+// IsCreatedInLoad reports whether the comment was created by the benchmarker, not loaded from the dump.
+func (m *Comment) IsCreatedInLoad() bool {
+	return !m.trackedAt.IsZero()
+}
+
 type CommentSet struct {
 	Set[*Comment]
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUserSetLease(t *testing.T) {
+	users := &UserSet{}
+	alice := &User{ID: 1, AccountName: "alice"}
+	bob := &User{ID: 2, AccountName: "bob"}
+	banned := &User{ID: 3, AccountName: "banned", DeleteFlag: 1}
+	users.Add(alice)
+	users.Add(bob)
+	users.Add(banned)
+
+	first, ok := users.TryLease(IsActiveUser)
+	if !ok {
+		t.Fatal("no user is leased")
+	}
+	second, ok := users.TryLease(IsActiveUser)
+	if !ok {
+		t.Fatal("no user is leased")
+	}
+	if first == second {
+		t.Fatalf("%s is leased twice", first.AccountName)
+	}
+
+	if user, ok := users.TryLease(IsActiveUser); ok {
+		t.Fatalf("%s is leased while all active users are busy", user.AccountName)
+	}
+	if user, ok := users.TryLease(IsBannedUser); !ok || user != banned {
+		t.Fatalf("banned user is not leased: %v", user)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if user, ok := users.Lease(ctx, IsActiveUser); ok {
+		t.Fatalf("%s is leased while all active users are busy", user.AccountName)
+	}
+
+	leased := make(chan *User)
+	go func() {
+		user, _ := users.Lease(context.Background(), IsActiveUser)
+		leased <- user
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	users.Release(first)
+
+	select {
+	case user := <-leased:
+		if user != first {
+			t.Errorf("released user, expected(%s) != actual(%v)", first.AccountName, user)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lease does not return after Release")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if user, ok := users.Lease(ctx, func(u *User) bool { return u.ID == 0 }); ok {
+		t.Errorf("%s is leased by unmatched filter", user.AccountName)
+	}
+}
+
+func TestUserSetLeaseWaitsForMatchingUser(t *testing.T) {
+	users := &UserSet{}
+	alice := &User{ID: 1, AccountName: "alice"}
+	users.Add(alice)
+
+	if _, ok := users.TryLease(IsActiveUser); !ok {
+		t.Fatal("no user is leased")
+	}
+	alice.SetLoggedIn(true)
+
+	leased := make(chan *User)
+	go func() {
+		user, _ := users.Lease(context.Background(), IsLoggedOutUser)
+		leased <- user
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	alice.ClearAgent()
+	users.Release(alice)
+
+	select {
+	case user := <-leased:
+		if user != alice {
+			t.Errorf("logged out user, expected(%s) != actual(%v)", alice.AccountName, user)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lease does not return after the user is logged out")
+	}
+}
+
+func TestUserSetLeasePair(t *testing.T) {
+	users := &UserSet{}
+	alice := &User{ID: 1, AccountName: "alice"}
+	bob := &User{ID: 2, AccountName: "bob"}
+	users.Add(alice)
+	users.Add(bob)
+
+	first, second, ok := users.leasePair(context.Background(), IsActiveUser)
+	if !ok || first == second {
+		t.Fatalf("two different users are expected: %v, %v", first, second)
+	}
+	users.Release(second)
+
+	// the free user is not held while the other one is busy, and the failed
+	// lease waits until the busy one is released.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		users.Release(first)
+	}()
+	startedAt := time.Now()
+	if _, _, ok := users.leasePair(context.Background(), IsActiveUser); ok {
+		t.Fatal("pair is leased while one user is busy")
+	}
+	if elapsed := time.Since(startedAt); elapsed < 50*time.Millisecond {
+		t.Errorf("failed pair lease returned without waiting: %s", elapsed)
+	}
+	if user, ok := users.TryLease(IsActiveUser); !ok {
+		t.Errorf("no user is released by the failed pair lease: %v", user)
+	}
+
+	// it also gives up when ctx is done.
+	users.TryLease(IsActiveUser)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, ok := users.leasePair(ctx, IsActiveUser); ok {
+		t.Fatal("pair is leased while both users are busy")
+	}
+}
+
+func TestUserSetKeepSession(t *testing.T) {
+	users := &UserSet{}
+	for i := 1; i <= 3; i++ {
+		users.Add(&User{ID: i, AccountName: fmt.Sprintf("user%d", i)})
+	}
+
+	kept := []*User{}
+	for i := 0; i < 3; i++ {
+		user, _ := users.TryLease(IsLoggedOutUser)
+		user.SetLoggedIn(true)
+		if users.KeepSession(user, 2) {
+			kept = append(kept, user)
+		} else {
+			user.ClearAgent()
+		}
+		users.Release(user)
+	}
+	if len(kept) != 2 {
+		t.Fatalf("kept sessions, expected(2) != actual(%d)", len(kept))
+	}
+
+	// a returning user keeps the session without taking another slot.
+	user, _ := users.Lease(context.Background(), func(u *User) bool { return u == kept[0] })
+	if !users.KeepSession(user, 2) {
+		t.Error("returning user cannot keep the session")
+	}
+
+	// ending the session frees the slot.
+	user.ClearAgent()
+	users.Release(user)
+
+	other, _ := users.TryLease(IsLoggedOutUser)
+	other.SetLoggedIn(true)
+	if !users.KeepSession(other, 2) {
+		t.Error("slot of the ended session is not freed")
+	}
+}
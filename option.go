@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -10,33 +11,116 @@ import (
 
 type Option struct {
 	TargetHost               string
+	TargetScheme             string
+	TargetAssignment         string
+	AssetHost                string
+	CACert                   string
+	InsecureSkipVerify       bool
+	ServerName               string
+	DisableHTTP2             bool
+	MaxIdleConnsPerHost      int
+	MaxConnsPerHost          int
+	IdleConnTimeout          time.Duration
+	DisableKeepAliveRate     float64
 	RequestTimeout           time.Duration
 	InitializeRequestTimeout time.Duration
 	ExitErrorOnFail          bool
+	DumpDir                  string
+	FreshnessGracePeriod     time.Duration
+	ScenarioConfig           string
+	TraceFile                string
+	TraceFailuresOnly        bool
+	TraceMaxEntries          int
+	KeepSessionRate          float64
+	ArrivalRate              float64
+	MaxInFlight              int
+	MaxQueued                int
+	ThinkTime                ThinkTime
+
+	tracer    *Tracer
+	transport *http.Transport
+	metrics   *Metrics
 }
 
 func (o Option) String() string {
 	args := []string{
 		"benchmarker",
 		fmt.Sprintf("--target-host=%s", o.TargetHost),
+		fmt.Sprintf("--target-scheme=%s", o.scheme()),
+		fmt.Sprintf("--target-assignment=%s", o.TargetAssignment),
+		fmt.Sprintf("--asset-host=%s", o.AssetHost),
+		fmt.Sprintf("--ca-cert=%s", o.CACert),
+		fmt.Sprintf("--insecure-skip-verify=%v", o.InsecureSkipVerify),
+		fmt.Sprintf("--server-name=%s", o.ServerName),
+		fmt.Sprintf("--disable-http2=%v", o.DisableHTTP2),
+		fmt.Sprintf("--max-idle-conns-per-host=%d", o.MaxIdleConnsPerHost),
+		fmt.Sprintf("--max-conns-per-host=%d", o.MaxConnsPerHost),
+		fmt.Sprintf("--idle-conn-timeout=%s", o.IdleConnTimeout.String()),
+		fmt.Sprintf("--disable-keep-alive-rate=%v", o.DisableKeepAliveRate),
 		fmt.Sprintf("--request-timeout=%s", o.RequestTimeout.String()),
 		fmt.Sprintf("--initialize-request-timeout=%s", o.InitializeRequestTimeout.String()),
 		fmt.Sprintf("--exit-error-on-fail=%v", o.ExitErrorOnFail),
+		fmt.Sprintf("--dump-dir=%s", o.DumpDir),
+		fmt.Sprintf("--freshness-grace-period=%s", o.FreshnessGracePeriod.String()),
+		fmt.Sprintf("--scenario-config=%s", o.ScenarioConfig),
+		fmt.Sprintf("--trace=%s", o.TraceFile),
+		fmt.Sprintf("--trace-failures-only=%v", o.TraceFailuresOnly),
+		fmt.Sprintf("--trace-max-entries=%d", o.TraceMaxEntries),
+		fmt.Sprintf("--keep-session-rate=%v", o.KeepSessionRate),
+		fmt.Sprintf("--arrival-rate=%v", o.ArrivalRate),
+		fmt.Sprintf("--max-in-flight=%d", o.MaxInFlight),
+		fmt.Sprintf("--max-queued=%d", o.MaxQueued),
+		fmt.Sprintf("--think-time=%s", o.ThinkTime),
 	}
 	return strings.Join(args, " ")
 }
 
-func (o Option) NewAgent(forInitialize bool) (*agent.Agent, error) {
+// Timeout returns the request timeout of routes in class.
+func (o Option) Timeout(class TimeoutClass) time.Duration {
+	if class == TimeoutInitialize {
+		return o.InitializeRequestTimeout
+	}
+	return o.RequestTimeout
+}
+
+// NewAgent returns an agent whose requests time out after the timeout of class.
+func (o Option) NewAgent(class TimeoutClass, options ...agent.AgentOption) (*agent.Agent, error) {
+	targets := o.Targets()
+	if class == TimeoutInitialize && len(targets) > 0 {
+		// all targets share the same database, so the first one is enough.
+		return o.newAgent(targets[0], class, options...)
+	}
+	return o.newAgent(o.pickTarget(0), class, options...)
+}
+
+// NewUserAgent returns an agent for a new session of user.
+func (o Option) NewUserAgent(user *User) (*agent.Agent, error) {
+	return o.newAgent(o.pickTarget(user.ID), TimeoutDefault)
+}
+
+func (o Option) newAgent(target string, class TimeoutClass, options ...agent.AgentOption) (*agent.Agent, error) {
 	agentOptions := []agent.AgentOption{
-		agent.WithBaseURL(fmt.Sprintf("http://%s/", o.TargetHost)),
-		agent.WithCloneTransport(agent.DefaultTransport),
+		agent.WithBaseURL(fmt.Sprintf("%s://%s/", o.scheme(), target)),
+		agent.WithCloneTransport(o.baseTransport()),
+		agent.WithTimeout(o.Timeout(class)),
+	}
+	agentOptions = append(agentOptions, options...)
+
+	ag, err := agent.NewAgent(agentOptions...)
+	if err != nil {
+		return nil, err
 	}
 
-	if forInitialize {
-		agentOptions = append(agentOptions, agent.WithTimeout(o.InitializeRequestTimeout))
-	} else {
-		agentOptions = append(agentOptions, agent.WithTimeout(o.RequestTimeout))
+	o.applyKeepAlive(ag)
+	if o.tracer != nil {
+		o.tracer.Wrap(ag)
 	}
+	ag.HttpClient.Transport = &targetTransport{base: ag.HttpClient.Transport, assetHost: o.AssetHost, targets: o.Targets(), host: o.ServerName, metrics: o.metrics}
+
+	return ag, nil
+}
 
-	return agent.NewAgent(agentOptions...)
+// NewAnonymousAgent returns an agent of a visitor who never keeps cookies.
+func (o Option) NewAnonymousAgent() (*agent.Agent, error) {
+	return o.NewAgent(TimeoutDefault, agent.WithNoCookie())
 }
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/isucon/isucandar/agent"
+)
+
+const replayCSRFField = "csrf_token"
+
+var (
+	replaySkipHeaders = map[string]bool{
+		"Cookie":            true,
+		"Host":              true,
+		"Content-Length":    true,
+		"If-None-Match":     true,
+		"If-Modified-Since": true,
+	}
+)
+
+func RunReplay(args []string) error {
+	var option Option
+
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	flags.StringVar(&option.TargetHost, "target-host", DefaultTargetHost, "Benchmark target host with port")
+	flags.StringVar(&option.TargetScheme, "target-scheme", SchemeHTTP, "Scheme of target host: http or https")
+	flags.StringVar(&option.CACert, "ca-cert", "", "PEM file of CA certificates trusted in addition to the system pool")
+	flags.BoolVar(&option.InsecureSkipVerify, "insecure-skip-verify", false, "Skip verification of server certificates")
+	flags.StringVar(&option.AssetHost, "asset-host", "", "Host with port serving /image/ and static assets in the trace")
+	flags.StringVar(&option.ServerName, "server-name", "", "Host header and TLS server name sent to the target instead of its host")
+	flags.DurationVar(&option.RequestTimeout, "request-timeout", DefaultRequestTimeout, "Default request timeout")
+	flags.DurationVar(&option.InitializeRequestTimeout, "initialize-request-timeout", DefaultinitializeRequestTimeout, "Initialize request timeout")
+	harFile := flags.String("har", "", "HAR file recorded with --trace (required)")
+	flags.Parse(args)
+
+	if *harFile == "" {
+		flags.Usage()
+		return errors.New("--har is required")
+	}
+
+	if err := option.SetupTransport(); err != nil {
+		return err
+	}
+
+	har, err := LoadHAR(*harFile)
+	if err != nil {
+		return err
+	}
+
+	entries := har.Log.Entries
+	if len(entries) == 0 {
+		return errors.New("no entries in HAR file")
+	}
+
+	AdminLogger.Printf("replay %d entries against %s", len(entries), option.TargetHost)
+
+	result, err := ReplayEntries(context.Background(), option, entries)
+	if err != nil {
+		return err
+	}
+
+	ContestantLogger.Printf("replayed: %d, skipped: %d, mismatches: %d", result.Replayed, result.Skipped, result.Mismatches)
+
+	return nil
+}
+
+type ReplayResult struct {
+	Replayed   int64
+	Skipped    int64
+	Mismatches int64
+}
+
+// ReplayEntries sends entries keeping their recorded timing. Entries of each
+// recorded agent are replayed in order with an agent of their own, and the
+// agents run in parallel. Entries with truncated request bodies are skipped.
+func ReplayEntries(ctx context.Context, option Option, entries []*HAREntry) (*ReplayResult, error) {
+	result := &ReplayResult{}
+	if len(entries) == 0 {
+		return result, nil
+	}
+
+	agentIDs := []int64{}
+	groups := map[int64][]int{}
+	for i, entry := range entries {
+		if _, ok := groups[entry.Agent]; !ok {
+			agentIDs = append(agentIDs, entry.Agent)
+		}
+		groups[entry.Agent] = append(groups[entry.Agent], i)
+	}
+
+	agents := make([]*agent.Agent, len(agentIDs))
+	for i := range agentIDs {
+		ag, err := option.NewAgent(TimeoutDefault)
+		if err != nil {
+			return nil, err
+		}
+		agents[i] = ag
+	}
+
+	startedAt := time.Now()
+	recordedAt := entries[0].StartedDateTime
+
+	wg := &sync.WaitGroup{}
+	for i, agentID := range agentIDs {
+		wg.Add(1)
+		go func(ag *agent.Agent, indexes []int) {
+			defer wg.Done()
+
+			for _, i := range indexes {
+				entry := entries[i]
+				if wait := time.Until(startedAt.Add(entry.StartedDateTime.Sub(recordedAt))); wait > 0 {
+					time.Sleep(wait)
+				}
+
+				if postData := entry.Request.PostData; postData != nil && postData.Truncated {
+					atomic.AddInt64(&result.Skipped, 1)
+					AdminLogger.Printf("#%d %s %s : skipped as request body is truncated in trace", i, entry.Request.Method, entry.Request.URL)
+					continue
+				}
+
+				// entries of an agent are replayed one by one, so the timeout
+				// of the agent can follow each entry.
+				ag.HttpClient.Timeout = option.Timeout(entryTimeoutClass(entry))
+				status, err := replayEntry(ctx, ag, entry, option.AssetHost)
+				atomic.AddInt64(&result.Replayed, 1)
+				switch {
+				case err != nil:
+					atomic.AddInt64(&result.Mismatches, 1)
+					ContestantLogger.Printf("#%d %s %s : %v", i, entry.Request.Method, entry.Request.URL, err)
+				case status != entry.Response.Status:
+					atomic.AddInt64(&result.Mismatches, 1)
+					ContestantLogger.Printf("#%d %s %s : expected(%d) != actual(%d)", i, entry.Request.Method, entry.Request.URL, entry.Response.Status, status)
+				}
+
+				for _, failure := range entry.Failures {
+					AdminLogger.Printf("#%d recorded failure: %s", i, failure)
+				}
+			}
+		}(agents[i], groups[agentID])
+	}
+	wg.Wait()
+
+	return result, nil
+}
+
+func LoadHAR(harFile string) (*HAR, error) {
+	file, err := os.Open(harFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	har := &HAR{}
+	if err := json.NewDecoder(file).Decode(har); err != nil {
+		return nil, err
+	}
+
+	return har, nil
+}
+
+func entryTimeoutClass(entry *HAREntry) TimeoutClass {
+	if u, err := url.Parse(entry.Request.URL); err == nil && u.Path == RouteGetInitialize.Pattern {
+		return TimeoutInitialize
+	}
+	return TimeoutDefault
+}
+
+func replayEntry(ctx context.Context, ag *agent.Agent, entry *HAREntry, assetHost string) (int, error) {
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	var body io.Reader
+	if postData := entry.Request.PostData; postData != nil {
+		raw := []byte(postData.Text)
+		if postData.Encoding == "base64" {
+			if raw, err = base64.StdEncoding.DecodeString(postData.Text); err != nil {
+				return 0, err
+			}
+		}
+		// the recorded token belongs to the session of the trace.
+		if bytes.Contains(raw, []byte(replayCSRFField)) {
+			token, err := fetchCSRFToken(ctx, ag)
+			if err != nil {
+				return 0, err
+			}
+			if raw, err = rewriteCSRFToken(entryContentType(entry), raw, token); err != nil {
+				return 0, err
+			}
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	// requests rewritten to the asset host are recorded with its URL.
+	target := u.RequestURI()
+	if assetHost != "" && u.Host == assetHost {
+		target = u.String()
+	}
+
+	req, err := ag.NewRequest(entry.Request.Method, target, body)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, header := range entry.Request.Headers {
+		if replaySkipHeaders[http.CanonicalHeaderKey(header.Name)] {
+			continue
+		}
+		req.Header.Set(header.Name, header.Value)
+	}
+
+	res, err := ag.Do(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	return res.StatusCode, nil
+}
+
+func entryContentType(entry *HAREntry) string {
+	for _, header := range entry.Request.Headers {
+		if http.CanonicalHeaderKey(header.Name) == "Content-Type" {
+			return header.Value
+		}
+	}
+	return entry.Request.PostData.MimeType
+}
+
+// fetchCSRFToken returns the CSRF token of the current session of ag.
+func fetchCSRFToken(ctx context.Context, ag *agent.Agent) (string, error) {
+	req, err := ag.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := ag.Do(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch CSRF token: %w", err)
+	}
+	defer res.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch CSRF token: %w", err)
+	}
+	token, ok := doc.Find(`input[name="csrf_token"]`).First().Attr("value")
+	if !ok || token == "" {
+		return "", errors.New("CSRF token is not found in /")
+	}
+
+	return token, nil
+}
+
+// rewriteCSRFToken replaces the csrf_token field of a form body with token.
+func rewriteCSRFToken(contentType string, raw []byte, token string) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := values[replayCSRFField]; ok {
+			values.Set(replayCSRFField, token)
+		}
+		return []byte(values.Encode()), nil
+	case "multipart/form-data":
+		reader := multipart.NewReader(bytes.NewReader(raw), params["boundary"])
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		// keep the boundary in Content-Type of the recorded request.
+		if err := writer.SetBoundary(params["boundary"]); err != nil {
+			return nil, err
+		}
+
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			w, err := writer.CreatePart(part.Header)
+			if err != nil {
+				return nil, err
+			}
+			if part.FormName() == replayCSRFField {
+				_, err = io.WriteString(w, token)
+			} else {
+				_, err = io.Copy(w, part)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return body.Bytes(), nil
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplayEntries(t *testing.T) {
+	fixture := NewMockFixture(3, 4, 8)
+	server := NewMockServer(fixture, MockOptions{}).Start(t)
+
+	option := Option{
+		TargetHost:     strings.TrimPrefix(server.URL, "http://"),
+		RequestTimeout: DefaultRequestTimeout,
+	}
+	if err := option.SetupTransport(); err != nil {
+		t.Fatal(err)
+	}
+
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	writer.WriteField("body", "replayed")
+	writer.WriteField("csrf_token", "recorded")
+	writer.Close()
+
+	recordedAt := time.Now()
+	entry := func(agentID int64, method, path string, status int, postData *HARPostData) *HAREntry {
+		recordedAt = recordedAt.Add(time.Millisecond)
+		entry := &HAREntry{
+			StartedDateTime: recordedAt,
+			Agent:           agentID,
+			Request:         HARRequest{Method: method, URL: "http://recorded.example" + path, PostData: postData},
+			Response:        HARResponse{Status: status},
+		}
+		if postData != nil {
+			entry.Request.Headers = []HARNameValue{{Name: "Content-Type", Value: postData.MimeType}}
+		}
+		return entry
+	}
+	urlencoded := func(values url.Values) *HARPostData {
+		return &HARPostData{MimeType: "application/x-www-form-urlencoded", Text: values.Encode()}
+	}
+
+	user := fixture.Users[0]
+	entries := []*HAREntry{
+		entry(1, http.MethodPost, "/login", http.StatusFound, urlencoded(url.Values{"account_name": {user.AccountName}, "password": {user.Password}})),
+		entry(2, http.MethodGet, "/login", http.StatusOK, nil),
+		entry(1, http.MethodPost, "/comment", http.StatusFound, urlencoded(url.Values{"post_id": {"1"}, "comment": {"replayed"}, "csrf_token": {"recorded"}})),
+		entry(1, http.MethodPost, "/", http.StatusFound, &HARPostData{MimeType: writer.FormDataContentType(), Text: form.String()}),
+		entry(1, http.MethodPost, "/", http.StatusFound, &HARPostData{MimeType: writer.FormDataContentType(), Text: form.String()[:16], Truncated: true}),
+		entry(2, http.MethodGet, "/", http.StatusOK, nil),
+	}
+
+	result, err := ReplayEntries(context.Background(), option, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Replayed != 5 || result.Skipped != 1 {
+		t.Errorf("expected(5 replayed, 1 skipped) != actual(%d replayed, %d skipped)", result.Replayed, result.Skipped)
+	}
+	if result.Mismatches != 0 {
+		t.Errorf("mismatches: %d", result.Mismatches)
+	}
+}
+
+func TestReplayEntriesTimeoutAndAssetHost(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/initialize" {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer target.Close()
+
+	var assetRequests int64
+	assets := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&assetRequests, 1)
+	}))
+	defer assets.Close()
+
+	option := Option{
+		TargetHost:               strings.TrimPrefix(target.URL, "http://"),
+		AssetHost:                strings.TrimPrefix(assets.URL, "http://"),
+		RequestTimeout:           100 * time.Millisecond,
+		InitializeRequestTimeout: time.Second,
+	}
+	if err := option.SetupTransport(); err != nil {
+		t.Fatal(err)
+	}
+
+	recordedAt := time.Now()
+	entries := []*HAREntry{}
+	for i, u := range []string{target.URL + "/", target.URL + "/initialize", assets.URL + "/image/1.png"} {
+		entries = append(entries, &HAREntry{
+			StartedDateTime: recordedAt.Add(time.Duration(i) * time.Millisecond),
+			Agent:           1,
+			Request:         HARRequest{Method: http.MethodGet, URL: u},
+			Response:        HARResponse{Status: http.StatusOK},
+		})
+	}
+
+	result, err := ReplayEntries(context.Background(), option, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mismatches != 0 {
+		t.Errorf("mismatches: %d", result.Mismatches)
+	}
+	if n := atomic.LoadInt64(&assetRequests); n != 1 {
+		t.Errorf("requests to asset host, expected(1) != actual(%d)", n)
+	}
+}
+
+func TestRewriteCSRFToken(t *testing.T) {
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	writer.WriteField("csrf_token", "recorded")
+	writer.WriteField("body", "csrf_token=recorded")
+	writer.Close()
+
+	body, err := rewriteCSRFToken(writer.FormDataContentType(), form.Bytes(), "fresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := multipart.NewReader(bytes.NewReader(body), writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := r.Value["csrf_token"]; len(token) != 1 || token[0] != "fresh" {
+		t.Errorf("csrf_token, expected(fresh) != actual(%v)", token)
+	}
+	if text := r.Value["body"]; len(text) != 1 || text[0] != "csrf_token=recorded" {
+		t.Errorf("body, expected(csrf_token=recorded) != actual(%v)", text)
+	}
+
+	body, err = rewriteCSRFToken("application/x-www-form-urlencoded", []byte("comment=a&csrf_token=recorded"), "fresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := url.ParseQuery(string(body)); values.Get("csrf_token") != "fresh" || values.Get("comment") != "a" {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
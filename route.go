@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/isucon/isucandar/agent"
+	"github.com/isucon/isucandar/score"
+)
+
+type TimeoutClass int
+
+const (
+	TimeoutDefault TimeoutClass = iota
+	TimeoutInitialize
+)
+
+var (
+	routeParamPattern = regexp.MustCompile(`:[a-z_]+`)
+)
+
+type Route struct {
+	Method         string
+	Pattern        string
+	Score          score.ScoreTag
+	ExpectedStatus int
+}
+
+var (
+	RouteGetInitialize = &Route{Method: http.MethodGet, Pattern: "/initialize", ExpectedStatus: 200}
+	RouteGetLogin      = &Route{Method: http.MethodGet, Pattern: "/login", Score: ScoreGETLogin, ExpectedStatus: 200}
+	RoutePostLogin     = &Route{Method: http.MethodPost, Pattern: "/login", Score: ScorePOSTLogin, ExpectedStatus: 302}
+	RouteGetRoot       = &Route{Method: http.MethodGet, Pattern: "/", Score: ScoreGETRoot, ExpectedStatus: 200}
+	RoutePostRoot      = &Route{Method: http.MethodPost, Pattern: "/", Score: ScorePOSTRoot, ExpectedStatus: 302}
+	RouteGetPost       = &Route{Method: http.MethodGet, Pattern: "/posts/:id", Score: ScoreGETPost, ExpectedStatus: 200}
+	RouteGetUser       = &Route{Method: http.MethodGet, Pattern: "/@:account_name", Score: ScoreGETUser, ExpectedStatus: 200}
+	RoutePostComment   = &Route{Method: http.MethodPost, Pattern: "/comment", Score: ScorePOSTComment, ExpectedStatus: 302}
+	RouteGetLogout     = &Route{Method: http.MethodGet, Pattern: "/logout", Score: ScoreGETLogout, ExpectedStatus: 302}
+)
+
+func (r *Route) Name() string {
+	return r.Method + " " + r.Pattern
+}
+
+func (r *Route) Path(params ...interface{}) string {
+	i := 0
+	return routeParamPattern.ReplaceAllStringFunc(r.Pattern, func(param string) string {
+		if i >= len(params) {
+			return param
+		}
+		value := url.PathEscape(fmt.Sprint(params[i]))
+		i++
+		return value
+	})
+}
+
+func (r *Route) NewRequest(ag *agent.Agent, body io.Reader, params ...interface{}) (*http.Request, error) {
+	return ag.NewRequest(r.Method, r.Path(params...), body)
+}
+
+// Do sends req with ag. Requests time out after the timeout of ag, so routes
+// with a longer timeout such as /initialize need an agent of their own.
+func (r *Route) Do(ctx context.Context, ag *agent.Agent, req *http.Request) (*http.Response, error) {
+	ctx = context.WithValue(ctx, routeContextKey{}, r)
+	ctx = context.WithValue(ctx, requestStartedAtKey{}, time.Now())
+	markFlowStarted(ctx)
+
+	return ag.Do(ctx, req)
+}
+
+func (r *Route) Validate(res *http.Response, validators ...ResponseValidator) ValidationError {
+	return ValidateResponse(res, append([]ResponseValidator{WithStatusCode(r.ExpectedStatus)}, validators...)...)
+}
+
+type routeContextKey struct{}
+
+type requestStartedAtKey struct{}
+
+func RouteOf(req *http.Request) *Route {
+	if req == nil {
+		return nil
+	}
+	route, _ := req.Context().Value(routeContextKey{}).(*Route)
+	return route
+}
+
+func RequestStartedAt(req *http.Request) (time.Time, bool) {
+	if req == nil {
+		return time.Time{}, false
+	}
+	startedAt, ok := req.Context().Value(requestStartedAtKey{}).(time.Time)
+	return startedAt, ok
+}
+
+func endpoint(r *http.Response) string {
+	if route := RouteOf(r.Request); route != nil {
+		return route.Name()
+	}
+	return r.Request.Method + " " + r.Request.URL.Path
+}
+
+type RouteStat struct {
+	Count    int64
+	Errors   int64
+	Statuses map[int]int64
+	Total    time.Duration
+	Max      time.Duration
+}
+
+type routeMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*RouteStat
+}
+
+func newRouteMetrics() *routeMetrics {
+	return &routeMetrics{stats: map[string]*RouteStat{}}
+}
+
+// Metrics collects stats of requests sent by agents of an Option.
+type Metrics struct {
+	Routes      *routeMetrics
+	Targets     *routeMetrics
+	Connections *connectionMetrics
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Routes:      newRouteMetrics(),
+		Targets:     newRouteMetrics(),
+		Connections: &connectionMetrics{opened: map[string]int64{}},
+	}
+}
+
+func (m *routeMetrics) Record(route *Route, elapsed time.Duration, res *http.Response, err error) {
+	m.record(route.Name(), elapsed, res, err)
+}
+
+func (m *routeMetrics) record(name string, elapsed time.Duration, res *http.Response, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat, ok := m.stats[name]
+	if !ok {
+		stat = &RouteStat{Statuses: map[int]int64{}}
+		m.stats[name] = stat
+	}
+
+	stat.Count++
+	stat.Total += elapsed
+	if elapsed > stat.Max {
+		stat.Max = elapsed
+	}
+	if err != nil {
+		stat.Errors++
+	} else {
+		stat.Statuses[res.StatusCode]++
+	}
+}
+
+func (m *routeMetrics) Report() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.stats))
+	for name := range m.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{}
+	for _, name := range names {
+		stat := m.stats[name]
+
+		codes := make([]int, 0, len(stat.Statuses))
+		for code := range stat.Statuses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+
+		statuses := []string{}
+		for _, code := range codes {
+			statuses = append(statuses, fmt.Sprintf("%d:%d", code, stat.Statuses[code]))
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"%s count=%d errors=%d avg=%s max=%s status=[%s]",
+			name, stat.Count, stat.Errors, (stat.Total/time.Duration(stat.Count)).Round(time.Microsecond), stat.Max.Round(time.Microsecond), strings.Join(statuses, " "),
+		))
+	}
+
+	return lines
+}
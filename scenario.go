@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/isucon/isucandar"
+	"github.com/isucon/isucandar/agent"
 	"github.com/isucon/isucandar/failure"
 	"github.com/isucon/isucandar/score"
 	"github.com/isucon/isucandar/worker"
@@ -16,36 +20,89 @@ const (
 	ErrCannotNewAgent  failure.StringCode = "agent"
 	ErrInvalidRequest  failure.StringCode = "request"
 	ErrInvalidResposne failure.StringCode = "response"
+	ErrInitialData     failure.StringCode = "initial-data"
 )
 
 const (
-	ScoreGETLogin  score.ScoreTag = "GET /login"
-	ScorePOSTLogin score.ScoreTag = "POST /login"
-	ScoreGETRoot   score.ScoreTag = "GET /"
-	ScorePOSTRoot  score.ScoreTag = "POST /"
+	InitialDataSamples     = 10
+	ValidationUserSamples  = 10
+	FreshnessPollInterval  = 200 * time.Millisecond
+	CrossUserSessionRounds = 2
+	// share of active users who may keep their session between flows.
+	MaxKeptSessionRatio = 0.5
+)
+
+const (
+	ScoreGETLogin    score.ScoreTag = "GET /login"
+	ScorePOSTLogin   score.ScoreTag = "POST /login"
+	ScoreGETRoot     score.ScoreTag = "GET /"
+	ScorePOSTRoot    score.ScoreTag = "POST /"
+	ScoreGETPost     score.ScoreTag = "GET /posts/:id"
+	ScoreGETUser     score.ScoreTag = "GET /@:account_name"
+	ScorePOSTComment score.ScoreTag = "POST /comment"
+	ScoreGETLogout   score.ScoreTag = "GET /logout"
+)
+
+const (
+	FlowLoginPost        = "login-post"
+	FlowCrossUserSession = "cross-user-session"
+	FlowBannedUser       = "banned-user"
+	FlowLoginFailure     = "login-failure"
+	FlowOrderedIndex     = "ordered-index"
+	FlowJourney          = "journey"
+	FlowAnonymous        = "anonymous"
+	FlowForgedWrite      = "forged-write"
+)
+
+var (
+	Flows = map[string]func(*Scenario, context.Context, *isucandar.BenchmarkStep){
+		FlowLoginPost:        (*Scenario).LoginPostFlow,
+		FlowCrossUserSession: (*Scenario).CrossUserSessionFlow,
+		FlowBannedUser:       (*Scenario).BannedUserFlow,
+		FlowLoginFailure:     (*Scenario).LoginFailureFlow,
+		FlowOrderedIndex:     (*Scenario).OrderedIndexFlow,
+		FlowJourney:          (*Scenario).JourneyFlow,
+		FlowAnonymous:        (*Scenario).AnonymousFlow,
+		FlowForgedWrite:      (*Scenario).ForgedWriteFlow,
+	}
 )
 
 type Scenario struct {
 	Option   Option
+	Config   ScenarioConfig
 	Users    UserSet
 	Posts    PostSet
 	Comments CommentSet
+	Arrivals arrivalMetrics
+
+	initialMaxPostID int
+	maxKeptSessions  int
 }
 
 func (s *Scenario) Prepare(ctx context.Context, step *isucandar.BenchmarkStep) error {
-	if err := s.Users.LoadJSON("./dump/users.json"); err != nil {
+	if err := s.Users.LoadJSON(filepath.Join(s.Option.DumpDir, DumpUsersFile)); err != nil {
 		return failure.NewError(ErrFailedLoadJSON, err)
 	}
 
-	if err := s.Posts.LoadJSON("./dump/posts.json"); err != nil {
+	if err := s.Posts.LoadJSON(filepath.Join(s.Option.DumpDir, DumpPostsFile)); err != nil {
 		return failure.NewError(ErrFailedLoadJSON, err)
 	}
 
-	if err := s.Comments.LoadJSON("./dump/commnets.json"); err != nil {
+	if err := s.Comments.LoadJSON(filepath.Join(s.Option.DumpDir, DumpCommentsFile)); err != nil {
 		return failure.NewError(ErrFailedLoadJSON, err)
 	}
 
-	ag, err := s.Option.NewAgent(true)
+	for i := 0; i < s.Comments.Len(); i++ {
+		comment := s.Comments.At(i)
+		if post, ok := s.Posts.Get(comment.PostID); ok {
+			post.AddComment(comment)
+		}
+	}
+
+	s.initialMaxPostID = s.Posts.MaxID()
+	s.maxKeptSessions = int(float64(len(s.Users.Filter(IsActiveUser))) * MaxKeptSessionRatio)
+
+	ag, err := s.Option.NewAgent(TimeoutInitialize)
 	if err != nil {
 		return failure.NewError(ErrCannotNewAgent, err)
 	}
@@ -56,73 +113,356 @@ func (s *Scenario) Prepare(ctx context.Context, step *isucandar.BenchmarkStep) e
 	}
 	defer res.Body.Close()
 
-	ValidateResponse(res, WithStatusCode(200)).Add(step)
+	RouteGetInitialize.Validate(res).Add(step)
+
+	return s.ValidateInitialData(ctx, step)
+}
+
+func (s *Scenario) ValidateInitialData(ctx context.Context, step *isucandar.BenchmarkStep) error {
+	ag, err := s.Option.NewAgent(TimeoutDefault)
+	if err != nil {
+		return failure.NewError(ErrCannotNewAgent, err)
+	}
+
+	validations := []ValidationError{}
+
+	validation, err := s.validateInitialIndex(ctx, ag)
+	if err != nil {
+		return failure.NewError(ErrInvalidRequest, err)
+	}
+	validations = append(validations, validation)
+
+	for i := 0; i < InitialDataSamples && s.Users.Len() > 0; i++ {
+		user := s.Users.At(rand.Intn(s.Users.Len()))
+
+		validation, err := s.validateInitialUser(ctx, ag, user)
+		if err != nil {
+			return failure.NewError(ErrInvalidRequest, err)
+		}
+		validations = append(validations, validation)
+	}
+
+	for i := 0; i < InitialDataSamples && s.Posts.Len() > 0; i++ {
+		post := s.Posts.At(rand.Intn(s.Posts.Len()))
+		user, ok := s.Users.Get(post.UserID)
+		if !ok {
+			return failure.NewError(ErrInitialData, fmt.Errorf("user %d of post %d is not found in dump", post.UserID, post.ID))
+		}
+
+		validation, err := s.validateInitialPost(ctx, ag, post, user)
+		if err != nil {
+			return failure.NewError(ErrInvalidRequest, err)
+		}
+		validations = append(validations, validation)
+	}
+
+	for i := 0; i < InitialDataSamples && s.Comments.Len() > 0; i++ {
+		comment := s.Comments.At(rand.Intn(s.Comments.Len()))
+		post, ok := s.Posts.Get(comment.PostID)
+		if !ok {
+			return failure.NewError(ErrInitialData, fmt.Errorf("post %d of comment %d is not found in dump", comment.PostID, comment.ID))
+		}
+		postUser, ok := s.Users.Get(post.UserID)
+		if !ok || postUser.DeleteFlag != 0 {
+			continue
+		}
+		commentUser, ok := s.Users.Get(comment.UserID)
+		if !ok || commentUser.DeleteFlag != 0 {
+			continue
+		}
+
+		validation, err := s.validateInitialPost(ctx, ag, post, postUser, comment)
+		if err != nil {
+			return failure.NewError(ErrInvalidRequest, err)
+		}
+		validations = append(validations, validation)
+	}
+
+	failed := false
+	for _, validation := range validations {
+		validation.Add(step)
+		if !validation.IsEmpty() {
+			failed = true
+		}
+	}
+
+	if failed {
+		return failure.NewError(ErrInitialData, fmt.Errorf("initial data does not match the dump, database may not be initialized"))
+	}
 
 	return nil
 }
 
+func (s *Scenario) validateInitialIndex(ctx context.Context, ag *agent.Agent) (ValidationError, error) {
+	res, err := GetRootAction(ctx, ag)
+	if err != nil {
+		return ValidationError{}, err
+	}
+	defer res.Body.Close()
+
+	return RouteGetRoot.Validate(res, WithInitialPosts(&s.Posts, s.initialMaxPostID, false)), nil
+}
+
+func (s *Scenario) validateInitialUser(ctx context.Context, ag *agent.Agent, user *User) (ValidationError, error) {
+	res, err := GetAccountAction(ctx, ag, user.AccountName)
+	if err != nil {
+		return ValidationError{}, err
+	}
+	defer res.Body.Close()
+
+	if user.DeleteFlag != 0 {
+		return ValidateResponse(res, WithStatusCode(404)), nil
+	}
+	return RouteGetUser.Validate(res, WithUserPage(user), WithInitialPosts(&s.Posts, s.initialMaxPostID, false)), nil
+}
+
+func (s *Scenario) validateInitialPost(ctx context.Context, ag *agent.Agent, post *Post, user *User, comments ...*Comment) (ValidationError, error) {
+	res, err := GetPostAction(ctx, ag, post.ID)
+	if err != nil {
+		return ValidationError{}, err
+	}
+	defer res.Body.Close()
+
+	if user.DeleteFlag != 0 {
+		return ValidateResponse(res, WithStatusCode(404)), nil
+	}
+	return RouteGetPost.Validate(res, WithPost(post, user, comments...), WithInitialPosts(&s.Posts, s.initialMaxPostID, true)), nil
+}
+
 func (s *Scenario) Load(ctx context.Context, step *isucandar.BenchmarkStep) error {
 	wg := &sync.WaitGroup{}
 
-	successCase, err := worker.NewWorker(func(ctx context.Context, _ int) {
-		if user, ok := s.Users.Get(rand.Intn(s.Users.Len())); ok {
-			if user.DeleteFlag != 0 {
-				return
-			}
+	config := s.Config
+	if len(config.Workers) == 0 {
+		config = DefaultScenarioConfig
+	}
 
-			if s.LoginSuccess(ctx, step, user) {
-				s.PostImage(ctx, step, user)
-			}
-			user.ClearAgent()
+	if s.Option.ArrivalRate > 0 {
+		return s.LoadOpenModel(ctx, step, config)
+	}
+
+	for _, workerConfig := range config.Workers {
+		workerConfig := workerConfig
+
+		opts := []worker.WorkerOption{worker.WithMaxParallelism(workerConfig.Parallelism)}
+		if workerConfig.LoopCount > 0 {
+			opts = append(opts, worker.WithLoopCount(workerConfig.LoopCount))
+		} else {
+			opts = append(opts, worker.WithInfinityLoop())
 		}
-	}, worker.WithInfinityLoop(), worker.WithMaxParallelism(4))
+
+		w, err := worker.NewWorker(func(ctx context.Context, _ int) {
+			Flows[workerConfig.PickFlow()](s, workerConfig.WithThinkTime(ctx), step)
+		}, opts...)
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Process(ctx)
+		}()
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (s *Scenario) LoginPostFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	user, ok := s.Users.Lease(ctx, IsActiveUser)
+	if !ok {
+		return
+	}
+	defer s.Users.Release(user)
+
+	// a returning user starts from the kept session instead of logging in.
+	loggedIn := false
+	if user.IsLoggedIn() {
+		loggedIn = s.CheckSession(ctx, step, user)
+	} else {
+		loggedIn = s.LoginSuccess(ctx, step, user)
+	}
+
+	if loggedIn && s.PostImage(ctx, step, user) && s.keepSession(user) {
+		return
+	}
+	user.ClearAgent()
+}
+
+// keepSession decides whether user keeps the session for the next visit.
+// Only some users keep sessions, so flows needing logged-out users find some.
+func (s *Scenario) keepSession(user *User) bool {
+	return rand.Float64() < s.Option.KeepSessionRate && s.Users.KeepSession(user, s.maxKeptSessions)
+}
+
+func (s *Scenario) CrossUserSessionFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	userA, userB, ok := s.Users.leasePair(ctx, IsLoggedOutUser)
+	if !ok {
+		return
+	}
+	defer s.Users.Release(userA)
+	defer s.Users.Release(userB)
+
+	s.CrossUserSession(ctx, step, userA, userB)
+	userA.ClearAgent()
+	userB.ClearAgent()
+}
+
+func (s *Scenario) BannedUserFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	user, ok := s.Users.Lease(ctx, IsBannedUser)
+	if !ok {
+		return
+	}
+	defer s.Users.Release(user)
+
+	s.BannedUser(ctx, step, user)
+}
+
+func (s *Scenario) LoginFailureFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	user, ok := s.Users.Lease(ctx, IsLoggedOutUser)
+	if !ok {
+		return
+	}
+	defer s.Users.Release(user)
+
+	s.LoginFailure(ctx, step, user)
+}
+
+func (s *Scenario) OrderedIndexFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	ag, err := s.Option.NewAnonymousAgent()
 	if err != nil {
-		return err
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		successCase.Process(ctx)
-	}()
+	s.OrderedIndex(ctx, step, ag)
+}
 
-	failureCase, err := worker.NewWorker(func(ctx context.Context, _ int) {
-		if user, ok := s.Users.Get(rand.Intn(s.Users.Len())); ok {
-			if user.DeleteFlag != 0 {
-				return
-			}
-			s.LoginFailure(ctx, step, user)
-		}
-	}, worker.WithLoopCount(20), worker.WithMaxParallelism(2))
+func (s *Scenario) AnonymousFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	ag, err := s.Option.NewAnonymousAgent()
 	if err != nil {
-		return err
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		failureCase.Process(ctx)
-	}()
+	s.AnonymousBrowse(ctx, step, ag)
+}
 
-	orderedCase, err := worker.NewWorker(func(ctx context.Context, _ int) {
-		if user, ok := s.Users.Get(rand.Intn(s.Users.Len())); ok {
-			s.OrderedIndex(ctx, step, user)
-		}
-	}, worker.WithInfinityLoop(), worker.WithMaxParallelism(2))
+func (s *Scenario) ForgedWriteFlow(ctx context.Context, step *isucandar.BenchmarkStep) {
+	ag, err := s.Option.NewAnonymousAgent()
 	if err != nil {
-		return err
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return
+	}
+	if !s.UnauthenticatedWrite(ctx, step, ag) {
+		return
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		orderedCase.Process(ctx)
-	}()
+	userA, userB, ok := s.Users.leasePair(ctx, IsLoggedOutUser)
+	if !ok {
+		return
+	}
+	defer s.Users.Release(userA)
+	defer s.Users.Release(userB)
+	defer userA.ClearAgent()
+	defer userB.ClearAgent()
+
+	if !s.CrossUserCSRF(ctx, step, userA, userB) {
+		return
+	}
+	userA.ClearAgent()
+
+	s.ExpiredSessionCSRF(ctx, step, userA)
+}
+
+func (s *Scenario) Validation(ctx context.Context, step *isucandar.BenchmarkStep) error {
+	ag, err := s.Option.NewAgent(TimeoutDefault)
+	if err != nil {
+		return failure.NewError(ErrCannotNewAgent, err)
+	}
+
+	rootRes, err := GetRootAction(ctx, ag)
+	if err != nil {
+		return failure.NewError(ErrInvalidRequest, err)
+	}
+	defer rootRes.Body.Close()
+
+	RouteGetRoot.Validate(rootRes, WithIndexPosts(&s.Users, &s.Posts)).Add(step)
+
+	createdComments := map[int][]*Comment{}
+	targets := s.Posts.Filter(func(p *Post) bool {
+		for _, comment := range p.Comments() {
+			if comment.IsCreatedInLoad() {
+				createdComments[p.ID] = append(createdComments[p.ID], comment)
+			}
+		}
+		return p.ID > s.initialMaxPostID || len(createdComments[p.ID]) > 0
+	})
+
+	latestPosts := map[int]*Post{}
+	for _, post := range targets {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		user, ok := s.Users.Get(post.UserID)
+		if !ok || user.DeleteFlag != 0 {
+			continue
+		}
+
+		if !validateCreatedPost(ctx, step, ag, post, user, createdComments[post.ID]...) {
+			continue
+		}
+
+		if post.ID > s.initialMaxPostID {
+			if latest, ok := latestPosts[user.ID]; !ok || post.GetCreatedAt().After(latest.GetCreatedAt()) {
+				latestPosts[user.ID] = post
+			}
+		}
+	}
+
+	sampled := 0
+	for userID, post := range latestPosts {
+		if sampled >= ValidationUserSamples {
+			break
+		}
+		sampled++
+
+		user, _ := s.Users.Get(userID)
+		validateLatestPost(ctx, step, ag, user, post)
+	}
 
-	wg.Wait()
 	return nil
 }
 
+// validateCreatedPost re-reads a post created or commented in load. It
+// returns false when the request itself failed.
+func validateCreatedPost(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent, post *Post, user *User, comments ...*Comment) bool {
+	res, err := GetPostAction(ctx, ag, post.ID)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer res.Body.Close()
+
+	RouteGetPost.Validate(res, WithPost(post, user, comments...)).Add(step)
+	return true
+}
+
+func validateLatestPost(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent, user *User, post *Post) {
+	res, err := GetAccountAction(ctx, ag, user.AccountName)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return
+	}
+	defer res.Body.Close()
+
+	RouteGetUser.Validate(res, WithUserPage(user, post)).Add(step)
+}
+
 func (s *Scenario) LoginSuccess(ctx context.Context, step *isucandar.BenchmarkStep, user *User) bool {
 	ag, err := user.GetAgent(s.Option)
 	if err != nil {
@@ -137,19 +477,17 @@ func (s *Scenario) LoginSuccess(ctx context.Context, step *isucandar.BenchmarkSt
 	}
 	defer getRes.Body.Close()
 
-	getValidation := ValidateResponse(getRes, WithStatusCode(200), WithAssets(ctx, ag))
+	getValidation := RouteGetLogin.Validate(getRes, WithAssets(ctx, ag))
 	getValidation.Add(step)
 
 	if getValidation.IsEmpty() {
-		step.AddScore(ScoreGETLogin)
+		step.AddScore(RouteGetLogin.Score)
 	} else {
 		return false
 	}
 
-	select {
-	case <-ctx.Done():
+	if !s.Think(ctx) {
 		return false
-	default:
 	}
 
 	postRes, err := PostLoginAction(ctx, ag, user.AccountName, user.Password)
@@ -159,10 +497,41 @@ func (s *Scenario) LoginSuccess(ctx context.Context, step *isucandar.BenchmarkSt
 	}
 	defer postRes.Body.Close()
 
-	postValidation := ValidateResponse(postRes, WithStatusCode(302), WithLocation("/"))
+	postValidation := RoutePostLogin.Validate(postRes, WithLocation("/"))
 
 	if postValidation.IsEmpty() {
-		step.AddScore(ScorePOSTLogin)
+		step.AddScore(RoutePostLogin.Score)
+	} else {
+		return false
+	}
+	user.SetLoggedIn(true)
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	return s.CheckSession(ctx, step, user)
+}
+
+func (s *Scenario) CheckSession(ctx context.Context, step *isucandar.BenchmarkStep, user *User) bool {
+	ag, err := user.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	getRes, err := GetRootAction(ctx, ag)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer getRes.Body.Close()
+
+	getValidation := RouteGetRoot.Validate(getRes, WithLoggedInUser(user))
+	getValidation.Add(step)
+
+	if getValidation.IsEmpty() {
+		step.AddScore(RouteGetRoot.Score)
 	} else {
 		return false
 	}
@@ -170,6 +539,28 @@ func (s *Scenario) LoginSuccess(ctx context.Context, step *isucandar.BenchmarkSt
 	return true
 }
 
+func (s *Scenario) CrossUserSession(ctx context.Context, step *isucandar.BenchmarkStep, users ...*User) bool {
+	for _, user := range users {
+		if !s.LoginSuccess(ctx, step, user) {
+			return false
+		}
+	}
+
+	for i := 0; i < CrossUserSessionRounds; i++ {
+		for _, user := range users {
+			if !s.Think(ctx) {
+				return false
+			}
+
+			if !s.CheckSession(ctx, step, user) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 func (s *Scenario) LoginFailure(ctx context.Context, step *isucandar.BenchmarkStep, user *User) bool {
 	ag, err := user.GetAgent(s.Option)
 	if err != nil {
@@ -184,19 +575,17 @@ func (s *Scenario) LoginFailure(ctx context.Context, step *isucandar.BenchmarkSt
 	}
 	defer getRes.Body.Close()
 
-	getValidation := ValidateResponse(getRes, WithStatusCode(200), WithAssets(ctx, ag))
+	getValidation := RouteGetLogin.Validate(getRes, WithAssets(ctx, ag))
 	getValidation.Add(step)
 
 	if getValidation.IsEmpty() {
-		step.AddScore(ScoreGETLogin)
+		step.AddScore(RouteGetLogin.Score)
 	} else {
 		return false
 	}
 
-	select {
-	case <-ctx.Done():
+	if !s.Think(ctx) {
 		return false
-	default:
 	}
 
 	postRes, err := PostLoginAction(ctx, ag, user.AccountName, user.Password+".invalid")
@@ -206,19 +595,17 @@ func (s *Scenario) LoginFailure(ctx context.Context, step *isucandar.BenchmarkSt
 	}
 	defer postRes.Body.Close()
 
-	postValidation := ValidateResponse(postRes, WithStatusCode(302), WithLocation("/login"))
+	postValidation := RoutePostLogin.Validate(postRes, WithLocation("/login"))
 	postValidation.Add(step)
 
 	if postValidation.IsEmpty() {
-		step.AddScore(ScorePOSTLogin)
+		step.AddScore(RoutePostLogin.Score)
 	} else {
 		return false
 	}
 
-	select {
-	case <-ctx.Done():
+	if !s.Think(ctx) {
 		return false
-	default:
 	}
 
 	redirectRes, err := GetLoginAction(ctx, ag)
@@ -228,11 +615,84 @@ func (s *Scenario) LoginFailure(ctx context.Context, step *isucandar.BenchmarkSt
 	}
 	defer getRes.Body.Close()
 
-	redirectValidation := ValidateResponse(redirectRes, WithStatusCode(200), WithIncludeBody("アカウント名かパスワードが間違っています"))
+	redirectValidation := RouteGetLogin.Validate(redirectRes, WithIncludeBody("アカウント名かパスワードが間違っています"))
 	redirectValidation.Add(step)
 
 	if redirectValidation.IsEmpty() {
-		step.AddScore(ScoreGETLogin)
+		step.AddScore(RouteGetLogin.Score)
+	} else {
+		return false
+	}
+
+	return true
+}
+
+func (s *Scenario) BannedUser(ctx context.Context, step *isucandar.BenchmarkStep, user *User) bool {
+	defer user.ClearAgent()
+
+	ag, err := user.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	postRes, err := PostLoginAction(ctx, ag, user.AccountName, user.Password)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer postRes.Body.Close()
+
+	postValidation := RoutePostLogin.Validate(postRes, WithLocation("/login"))
+	postValidation.Add(step)
+
+	if postValidation.IsEmpty() {
+		step.AddScore(RoutePostLogin.Score)
+	} else {
+		return false
+	}
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	userRes, err := GetAccountAction(ctx, ag, user.AccountName)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer userRes.Body.Close()
+
+	userValidation := ValidateResponse(userRes, WithStatusCode(404))
+	userValidation.Add(step)
+
+	if userValidation.IsEmpty() {
+		step.AddScore(ScoreGETUser)
+	} else {
+		return false
+	}
+
+	posts := s.Posts.Filter(func(p *Post) bool { return p.UserID == user.ID })
+	if len(posts) == 0 {
+		return true
+	}
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	getRes, err := GetPostAction(ctx, ag, posts[rand.Intn(len(posts))].ID)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer getRes.Body.Close()
+
+	getValidation := ValidateResponse(getRes, WithStatusCode(404))
+	getValidation.Add(step)
+
+	if getValidation.IsEmpty() {
+		step.AddScore(ScoreGETPost)
 	} else {
 		return false
 	}
@@ -254,19 +714,17 @@ func (s *Scenario) PostImage(ctx context.Context, step *isucandar.BenchmarkStep,
 	}
 	defer getRes.Body.Close()
 
-	getValidation := ValidateResponse(getRes, WithStatusCode(200), WithCSRFToken(user))
+	getValidation := RouteGetRoot.Validate(getRes, WithCSRFToken(user))
 	getValidation.Add(step)
 
 	if getValidation.IsEmpty() {
-		step.AddScore(ScoreGETRoot)
+		step.AddScore(RouteGetRoot.Score)
 	} else {
 		return false
 	}
 
-	select {
-	case <-ctx.Done():
+	if !s.Think(ctx) {
 		return false
-	default:
 	}
 
 	post := &Post{
@@ -281,19 +739,33 @@ func (s *Scenario) PostImage(ctx context.Context, step *isucandar.BenchmarkStep,
 	}
 	defer postRes.Body.Close()
 
-	postValidation := ValidateResponse(postRes, WithStatusCode(302))
+	postValidation := RoutePostRoot.Validate(postRes, WithPostLocation(post))
 	postValidation.Add(step)
 
 	if postValidation.IsEmpty() {
-		step.AddScore(ScorePOSTRoot)
+		step.AddScore(RoutePostRoot.Score)
 	} else {
 		return false
 	}
 
-	select {
-	case <-ctx.Done():
+	// no think time until the freshness check, as the grace period runs.
+	postedAt := time.Now()
+
+	postPageRes, err := GetPostAction(ctx, ag, post.ID)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer postPageRes.Body.Close()
+
+	postPageValidation := RouteGetPost.Validate(postPageRes, WithPostCreatedAt(post))
+	postPageValidation.Add(step)
+
+	if postPageValidation.IsEmpty() {
+		step.AddScore(RouteGetPost.Score)
+		s.Posts.Add(post)
+	} else {
 		return false
-	default:
 	}
 
 	redirectRes, err := GetRootAction(ctx, ag)
@@ -301,13 +773,69 @@ func (s *Scenario) PostImage(ctx context.Context, step *isucandar.BenchmarkStep,
 		step.AddError(failure.NewError(ErrInvalidRequest, err))
 		return false
 	}
-	defer getRes.Body.Close()
+	defer redirectRes.Body.Close()
 
-	redirectValidation := ValidateResponse(redirectRes, WithStatusCode(200), WithAssets(ctx, ag))
+	redirectValidation := RouteGetRoot.Validate(redirectRes, WithAssets(ctx, ag))
 	redirectValidation.Add(step)
 
 	if redirectValidation.IsEmpty() {
-		step.AddScore(ScoreGETRoot)
+		step.AddScore(RouteGetRoot.Score)
+	} else {
+		return false
+	}
+
+	return s.CheckFreshness(ctx, step, ag, post, postedAt)
+}
+
+func (s *Scenario) CheckFreshness(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent, post *Post, postedAt time.Time) bool {
+	for {
+		getValidation, ok := getFreshPost(ctx, step, ag, post)
+		if !ok {
+			return false
+		}
+
+		if getValidation.IsEmpty() {
+			step.AddScore(RouteGetRoot.Score)
+			return true
+		}
+
+		if !getValidation.IsOnly(ErrStaleContent) || time.Since(postedAt) > s.Option.FreshnessGracePeriod {
+			getValidation.Add(step)
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(FreshnessPollInterval):
+		}
+	}
+}
+
+func getFreshPost(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent, post *Post) (ValidationError, bool) {
+	getRes, err := GetRootAction(ctx, ag)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return ValidationError{}, false
+	}
+	defer getRes.Body.Close()
+
+	return RouteGetRoot.Validate(getRes, WithFreshPost(post)), true
+}
+
+func (s *Scenario) OrderedIndex(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent) bool {
+	getRes, err := GetRootAction(ctx, ag)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer getRes.Body.Close()
+
+	getValidation := RouteGetRoot.Validate(getRes, WithIndexPosts(&s.Users, &s.Posts))
+	getValidation.Add(step)
+
+	if getValidation.IsEmpty() {
+		step.AddScore(RouteGetRoot.Score)
 	} else {
 		return false
 	}
@@ -315,7 +843,148 @@ func (s *Scenario) PostImage(ctx context.Context, step *isucandar.BenchmarkStep,
 	return true
 }
 
-func (s *Scenario) OrderedIndex(ctx context.Context, step *isucandar.BenchmarkStep, user *User) bool {
+func (s *Scenario) AnonymousBrowse(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent) bool {
+	postIDs := []int{}
+
+	getRes, err := GetRootAction(ctx, ag)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer getRes.Body.Close()
+
+	getValidation := RouteGetRoot.Validate(getRes, WithAnonymousPage(), WithIndexPosts(&s.Users, &s.Posts), WithPostIDs(&postIDs))
+	getValidation.Add(step)
+
+	if getValidation.IsEmpty() {
+		step.AddScore(RouteGetRoot.Score)
+	} else {
+		return false
+	}
+
+	post, author, ok := s.pickListedPost(postIDs)
+	if !ok {
+		return true
+	}
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	comments := post.Comments()
+	postRes, err := GetPostAction(ctx, ag, post.ID)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer postRes.Body.Close()
+
+	postValidation := RouteGetPost.Validate(postRes, WithAnonymousPage(), WithPost(post, author, comments...))
+	postValidation.Add(step)
+
+	if postValidation.IsEmpty() {
+		step.AddScore(RouteGetPost.Score)
+	} else {
+		return false
+	}
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	userRes, err := GetAccountAction(ctx, ag, author.AccountName)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer userRes.Body.Close()
+
+	userValidation := RouteGetUser.Validate(userRes, WithAnonymousPage(), WithUserPage(author))
+	userValidation.Add(step)
+
+	if userValidation.IsEmpty() {
+		step.AddScore(RouteGetUser.Score)
+	} else {
+		return false
+	}
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	commentRes, err := PostCommentAction(ctx, ag, post.ID, randomText(), "")
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer commentRes.Body.Close()
+
+	commentValidation := RoutePostComment.Validate(commentRes, WithLocation("/login"))
+	commentValidation.Add(step)
+
+	return commentValidation.IsEmpty()
+}
+
+// pickListedPost picks a random post among postIDs listed on a page, with its
+// author. Posts created by other sessions may not be tracked yet and are skipped.
+func (s *Scenario) pickListedPost(postIDs []int) (*Post, *User, bool) {
+	posts := []*Post{}
+	for _, id := range postIDs {
+		if post, ok := s.Posts.Get(id); ok {
+			posts = append(posts, post)
+		}
+	}
+	if len(posts) == 0 {
+		return nil, nil, false
+	}
+
+	post := posts[rand.Intn(len(posts))]
+	author, ok := s.Users.Get(post.UserID)
+	if !ok {
+		return nil, nil, false
+	}
+	return post, author, true
+}
+
+// ForgedWrite submits a post and a comment which the application must refuse.
+func (s *Scenario) ForgedWrite(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent, csrfToken string, validators ...ResponseValidator) bool {
+	postRes, err := PostRootAction(ctx, ag, &Post{Mime: "image/png", Body: randomText()}, csrfToken)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer postRes.Body.Close()
+
+	postValidation := ValidateResponse(postRes, validators...)
+	postValidation.Add(step)
+
+	if !postValidation.IsEmpty() || s.Posts.Len() == 0 {
+		return postValidation.IsEmpty()
+	}
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	post := s.Posts.At(rand.Intn(s.Posts.Len()))
+	commentRes, err := PostCommentAction(ctx, ag, post.ID, randomText(), csrfToken)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer commentRes.Body.Close()
+
+	commentValidation := ValidateResponse(commentRes, validators...)
+	commentValidation.Add(step)
+
+	return commentValidation.IsEmpty()
+}
+
+func (s *Scenario) UnauthenticatedWrite(ctx context.Context, step *isucandar.BenchmarkStep, ag *agent.Agent) bool {
+	return s.ForgedWrite(ctx, step, ag, randomText(), WithStatusCode(302), WithLocation("/login"))
+}
+
+func (s *Scenario) LoadCSRFToken(ctx context.Context, step *isucandar.BenchmarkStep, user *User) bool {
 	ag, err := user.GetAgent(s.Option)
 	if err != nil {
 		step.AddError(failure.NewError(ErrCannotNewAgent, err))
@@ -329,14 +998,84 @@ func (s *Scenario) OrderedIndex(ctx context.Context, step *isucandar.BenchmarkSt
 	}
 	defer getRes.Body.Close()
 
-	getValidation := ValidateResponse(getRes, WithStatusCode(200), WithOrderedPosts())
+	getValidation := RouteGetRoot.Validate(getRes, WithLoggedInUser(user), WithCSRFToken(user))
 	getValidation.Add(step)
 
 	if getValidation.IsEmpty() {
-		step.AddScore(ScoreGETRoot)
+		step.AddScore(RouteGetRoot.Score)
+		return true
+	}
+	return false
+}
+
+func (s *Scenario) CrossUserCSRF(ctx context.Context, step *isucandar.BenchmarkStep, user *User, other *User) bool {
+	for _, u := range []*User{user, other} {
+		if !s.LoginSuccess(ctx, step, u) || !s.LoadCSRFToken(ctx, step, u) {
+			return false
+		}
+	}
+
+	if !s.Think(ctx) {
+		return false
+	}
+
+	ag, err := user.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	return s.ForgedWrite(ctx, step, ag, other.GetCSRFToken(), WithStatusCode(422))
+}
+
+func (s *Scenario) ExpiredSessionCSRF(ctx context.Context, step *isucandar.BenchmarkStep, user *User) bool {
+	if !s.LoginSuccess(ctx, step, user) || !s.LoadCSRFToken(ctx, step, user) {
+		return false
+	}
+	expiredToken := user.GetCSRFToken()
+
+	ag, err := user.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	logoutRes, err := GetLogoutAction(ctx, ag)
+	if err != nil {
+		step.AddError(failure.NewError(ErrInvalidRequest, err))
+		return false
+	}
+	defer logoutRes.Body.Close()
+
+	logoutValidation := RouteGetLogout.Validate(logoutRes, WithLocation("/"))
+	logoutValidation.Add(step)
+
+	if logoutValidation.IsEmpty() {
+		step.AddScore(RouteGetLogout.Score)
 	} else {
 		return false
 	}
 
-	return true
+	if !s.Think(ctx) {
+		return false
+	}
+
+	// the token is still in the cookie session, but the session is logged out.
+	if !s.ForgedWrite(ctx, step, ag, expiredToken, WithStatusCode(302), WithLocation("/login")) {
+		return false
+	}
+
+	// a new session must not accept the token of the previous one.
+	user.ClearAgent()
+	if !s.LoginSuccess(ctx, step, user) || !s.LoadCSRFToken(ctx, step, user) {
+		return false
+	}
+
+	ag, err = user.GetAgent(s.Option)
+	if err != nil {
+		step.AddError(failure.NewError(ErrCannotNewAgent, err))
+		return false
+	}
+
+	return s.ForgedWrite(ctx, step, ag, expiredToken, WithStatusCode(422))
 }
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/isucon/isucandar"
+	"github.com/isucon/isucandar/failure"
+)
+
+const mockLoadTimeout = 2 * time.Second
+
+func runMockBenchmark(t *testing.T, options MockOptions, config ScenarioConfig, optionFuncs ...func(*Option)) (*isucandar.BenchmarkResult, *Scenario) {
+	t.Helper()
+	return runMockBenchmarkWithTimeout(t, mockLoadTimeout, options, config, optionFuncs...)
+}
+
+// runMockBenchmarkWithTimeout is for workers with a loop count whose flows
+// may take longer than mockLoadTimeout, e.g. under the race detector.
+func runMockBenchmarkWithTimeout(t *testing.T, loadTimeout time.Duration, options MockOptions, config ScenarioConfig, optionFuncs ...func(*Option)) (*isucandar.BenchmarkResult, *Scenario) {
+	t.Helper()
+
+	fixture := NewMockFixture(10, 40, 120)
+	mock := NewMockServer(fixture, options)
+	server := mock.Start(t)
+
+	scenario := &Scenario{
+		Option: Option{
+			TargetHost:               strings.TrimPrefix(server.URL, "http://"),
+			RequestTimeout:           DefaultRequestTimeout,
+			InitializeRequestTimeout: DefaultinitializeRequestTimeout,
+			FreshnessGracePeriod:     DefaultFreshnessGracePeriod,
+			DumpDir:                  fixture.WriteDump(t),
+			metrics:                  NewMetrics(),
+		},
+		Config: config,
+	}
+	for _, f := range optionFuncs {
+		f(&scenario.Option)
+	}
+
+	benchmark, err := isucandar.NewBenchmark(
+		isucandar.WithoutPanicRecover(),
+		isucandar.WithLoadTimeout(loadTimeout),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	benchmark.AddScenario(scenario)
+	benchmark.Prepare(func(context.Context, *isucandar.BenchmarkStep) error {
+		mock.StartLoad()
+		return nil
+	})
+
+	return benchmark.Start(context.Background()), scenario
+}
+
+// assertNoErrors fails t with the errors of result. Requests in flight when
+// the load phase ends are cut off by its deadline, so those are ignored.
+func assertNoErrors(t *testing.T, result *isucandar.BenchmarkResult) {
+	t.Helper()
+
+	for _, err := range result.Errors.All() {
+		if errors.Is(err, context.DeadlineExceeded) {
+			continue
+		}
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// hasErrorCode reports whether an error of result has all of codes.
+func hasErrorCode(result *isucandar.BenchmarkResult, codes ...failure.Code) bool {
+	for _, err := range result.Errors.All() {
+		matched := true
+		for _, code := range codes {
+			matched = matched && failure.IsCode(err, code)
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func TestScenarioWithMockServer(t *testing.T) {
+	testCases := []struct {
+		name            string
+		keepSessionRate float64
+		thinkTime       ThinkTime
+	}{
+		{name: "cold sessions", keepSessionRate: 0},
+		{name: "returning sessions", keepSessionRate: 1},
+		{name: "thinking users", thinkTime: ThinkTime{Kind: ThinkUniform, Max: 100 * time.Millisecond}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testScenarioWithMockServer(t, func(o *Option) {
+				o.KeepSessionRate = tc.keepSessionRate
+				o.ThinkTime = tc.thinkTime
+			})
+		})
+	}
+}
+
+func testScenarioWithMockServer(t *testing.T, optionFunc func(*Option)) {
+	result, scenario := runMockBenchmark(t, MockOptions{}, ScenarioConfig{}, optionFunc)
+
+	assertNoErrors(t, result)
+
+	if score := SumScore(result); score <= 0 {
+		t.Errorf("score must be positive: %d", score)
+	}
+
+	if created := scenario.Posts.Filter(func(p *Post) bool { return p.ID > scenario.initialMaxPostID }); len(created) == 0 {
+		t.Error("no posts are tracked in PostSet")
+	}
+
+	if n := routeRequestCount(scenario.Option.metrics, RouteGetRoot); n == 0 {
+		t.Errorf("no requests to %s are recorded", RouteGetRoot.Name())
+	}
+}
+
+func routeRequestCount(metrics *Metrics, route *Route) int64 {
+	metrics.Routes.mu.Lock()
+	defer metrics.Routes.mu.Unlock()
+
+	if stat, ok := metrics.Routes.stats[route.Name()]; ok {
+		return stat.Count
+	}
+	return 0
+}
+
+func TestScenarioJourneyWithMockServer(t *testing.T) {
+	config := ScenarioConfig{
+		Workers: []WorkerConfig{{Name: "journey", Flows: map[string]int{FlowJourney: 1}, Parallelism: 4}},
+		Journey: JourneyConfig{
+			MaxSteps: 10,
+			Transitions: map[string]map[string]int{
+				JourneyTop:     {JourneyPost: 3, JourneyNewPost: 1},
+				JourneyPost:    {JourneyComment: 3, JourneyProfile: 1},
+				JourneyProfile: {JourneyPost: 1},
+				JourneyComment: {JourneyTop: 3, JourneyLogout: 1},
+				JourneyNewPost: {JourneyTop: 1},
+			},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, scenario := runMockBenchmark(t, MockOptions{}, config)
+
+	assertNoErrors(t, result)
+
+	commented := scenario.Posts.Filter(func(p *Post) bool {
+		for _, comment := range p.Comments() {
+			if comment.IsCreatedInLoad() {
+				return true
+			}
+		}
+		return false
+	})
+	if len(commented) == 0 {
+		t.Error("no comments are tracked")
+	}
+}
+
+func TestScenarioAnonymousWithMockServer(t *testing.T) {
+	config := ScenarioConfig{
+		Workers: []WorkerConfig{{Name: "anonymous", Flows: map[string]int{FlowAnonymous: 1, FlowOrderedIndex: 1}, Parallelism: 2}},
+	}
+
+	result, _ := runMockBenchmark(t, MockOptions{}, config)
+
+	assertNoErrors(t, result)
+
+	if score := SumScore(result); score <= 0 {
+		t.Errorf("score must be positive: %d", score)
+	}
+}
+
+func TestScenarioOpenModelWithMockServer(t *testing.T) {
+	result, scenario := runMockBenchmark(t, MockOptions{}, ScenarioConfig{}, func(o *Option) {
+		o.ArrivalRate = 20
+		o.MaxInFlight = 4
+	})
+
+	assertNoErrors(t, result)
+
+	// 2s of load at 20 sessions per second.
+	if n := scenario.Arrivals.Arrivals(); n < 30 || n > 41 {
+		t.Errorf("arrivals, expected(40) != actual(%d)", n)
+	}
+}
+
+func TestScenarioOpenModelDropsArrivals(t *testing.T) {
+	config := ScenarioConfig{
+		Workers: []WorkerConfig{{Name: "ordered", Flows: map[string]int{FlowOrderedIndex: 1}, Parallelism: 1}},
+	}
+
+	// a single slow session holds the only slot and nothing may wait for it.
+	_, scenario := runMockBenchmark(t, MockOptions{Delay: 500 * time.Millisecond}, config, func(o *Option) {
+		o.ArrivalRate = 20
+		o.MaxInFlight = 1
+		o.MaxQueued = 0
+	})
+
+	if n := scenario.Arrivals.Dropped(); n == 0 {
+		t.Error("no arrivals are dropped")
+	}
+	if n := scenario.Arrivals.Dropped(); n >= scenario.Arrivals.Arrivals() {
+		t.Errorf("all arrivals are dropped: %d", n)
+	}
+}
+
+func TestScenarioMultipleTargetsWithMockServer(t *testing.T) {
+	result, scenario := runMockBenchmark(t, MockOptions{}, ScenarioConfig{}, func(o *Option) {
+		// two names of the mock server act as two targets.
+		port := o.TargetHost[strings.LastIndex(o.TargetHost, ":"):]
+		o.TargetHost = "127.0.0.1" + port + ",localhost" + port
+		o.TargetAssignment = TargetSticky
+		o.AssetHost = "127.0.0.1" + port
+	})
+
+	assertNoErrors(t, result)
+
+	for _, target := range scenario.Option.Targets() {
+		if targetRequestCount(scenario.Option.metrics, target) == 0 {
+			t.Errorf("no requests to %s", target)
+		}
+	}
+}
+
+func targetRequestCount(metrics *Metrics, target string) int64 {
+	metrics.Targets.mu.Lock()
+	defer metrics.Targets.mu.Unlock()
+
+	if stat, ok := metrics.Targets.stats[target]; ok {
+		return stat.Count
+	}
+	return 0
+}
+
+func TestJourneyConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		transitions map[string]map[string]int
+		valid       bool
+	}{
+		{name: "default", transitions: DefaultJourneyConfig.Transitions, valid: true},
+		{name: "no top", transitions: map[string]map[string]int{JourneyPost: {JourneyLogout: 1}}},
+		{name: "unknown state", transitions: map[string]map[string]int{JourneyTop: {"search": 1}}},
+		{name: "dead end", transitions: map[string]map[string]int{JourneyTop: {JourneyPost: 1}}},
+		{name: "from logout", transitions: map[string]map[string]int{JourneyTop: {JourneyLogout: 1}, JourneyLogout: {JourneyTop: 1}}},
+		{name: "zero weight", transitions: map[string]map[string]int{JourneyTop: {JourneyLogout: 0}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := JourneyConfig{Transitions: tc.transitions}.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("invalid transitions are accepted")
+			}
+		})
+	}
+}
+
+func TestScenarioDetectsBrokenServer(t *testing.T) {
+	testCases := []struct {
+		name       string
+		options    MockOptions
+		config     ScenarioConfig
+		optionFunc func(*Option)
+		// loadTimeout is for flows which must finish once to be detected.
+		loadTimeout time.Duration
+		// sent is the number of requests per route which must be sent.
+		sent  map[*Route]int64
+		phase failure.Code
+		code  failure.Code
+	}{
+		{
+			name:    "wrong order",
+			options: MockOptions{WrongOrder: true},
+			config:  ScenarioConfig{Workers: []WorkerConfig{{Flows: map[string]int{FlowOrderedIndex: 1}, Parallelism: 1}}},
+			phase:   isucandar.ErrLoad,
+			code:    ErrInvalidPostOrder,
+		},
+		{
+			name:    "broken assets",
+			options: MockOptions{BrokenAssets: true},
+			config:  ScenarioConfig{Workers: []WorkerConfig{{Flows: map[string]int{FlowLoginFailure: 1}, Parallelism: 1, LoopCount: 1}}},
+			phase:   isucandar.ErrLoad,
+			code:    ErrInvalidAsset,
+		},
+		{
+			name:    "csrf token ignored",
+			options: MockOptions{IgnoreCSRF: true},
+			config:  ScenarioConfig{Workers: []WorkerConfig{{Flows: map[string]int{FlowForgedWrite: 1}, Parallelism: 1, LoopCount: 1}}},
+			// the unauthenticated write and the one with the token of another user.
+			loadTimeout: 30 * time.Second,
+			sent:        map[*Route]int64{RoutePostRoot: 2},
+			phase:       isucandar.ErrLoad,
+			code:        ErrInvalidStatusCode,
+		},
+		{
+			name:    "not initialized",
+			options: MockOptions{NotInitialized: true},
+			config:  ScenarioConfig{Workers: []WorkerConfig{{Flows: map[string]int{FlowOrderedIndex: 1}, Parallelism: 1, LoopCount: 1}}},
+			phase:   isucandar.ErrPrepare,
+			code:    ErrInitialData,
+		},
+		{
+			name:    "slow responses",
+			options: MockOptions{Delay: time.Second},
+			config:  ScenarioConfig{Workers: []WorkerConfig{{Flows: map[string]int{FlowOrderedIndex: 1}, Parallelism: 1}}},
+			// requests time out before the load phase ends.
+			optionFunc: func(o *Option) { o.RequestTimeout = 500 * time.Millisecond },
+			phase:      isucandar.ErrLoad,
+			code:       ErrInvalidRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			optionFuncs := []func(*Option){}
+			if tc.optionFunc != nil {
+				optionFuncs = append(optionFuncs, tc.optionFunc)
+			}
+			loadTimeout := tc.loadTimeout
+			if loadTimeout == 0 {
+				loadTimeout = mockLoadTimeout
+			}
+			result, scenario := runMockBenchmarkWithTimeout(t, loadTimeout, tc.options, tc.config, optionFuncs...)
+
+			for route, expected := range tc.sent {
+				if n := routeRequestCount(scenario.Option.metrics, route); n < expected {
+					t.Errorf("requests to %s, expected(>= %d) != actual(%d)", route.Name(), expected, n)
+				}
+			}
+
+			if !hasErrorCode(result, tc.phase, tc.code) {
+				t.Errorf("%s is not reported in %s: %v", tc.code.ErrorCode(), tc.phase.ErrorCode(), result.Errors.All())
+			}
+		})
+	}
+}
@@ -48,6 +48,32 @@ func (s *Set[T]) Get(id int) (T, bool) {
 	return model, ok
 }
 
+func (s *Set[T]) Filter(f func(T) bool) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	models := []T{}
+	for _, model := range s.list {
+		if f(model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+func (s *Set[T]) MaxID() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	max := 0
+	for id := range s.dict {
+		if id > max {
+			max = id
+		}
+	}
+	return max
+}
+
 func (s *Set[T]) Add(model T) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
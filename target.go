@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TargetRoundRobin = "round-robin"
+	TargetSticky     = "sticky"
+)
+
+var (
+	// paths served by AssetHost instead of the target of the session.
+	assetPathPrefixes = []string{"/image/", "/css/", "/js/", "/img/", "/favicon.ico"}
+
+	targetCounter uint64
+)
+
+// Targets returns hosts listed in TargetHost separated by commas.
+func (o Option) Targets() []string {
+	targets := []string{}
+	for _, host := range strings.Split(o.TargetHost, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			targets = append(targets, host)
+		}
+	}
+	return targets
+}
+
+func ValidateTargetAssignment(assignment string) error {
+	switch assignment {
+	case "", TargetRoundRobin, TargetSticky:
+		return nil
+	}
+	return fmt.Errorf("unknown target assignment %q: %s or %s is expected", assignment, TargetRoundRobin, TargetSticky)
+}
+
+// pickTarget returns the target of a new session. Sessions of a user go to
+// the same target with the sticky assignment; userID is 0 for visitors.
+func (o Option) pickTarget(userID int) string {
+	targets := o.Targets()
+	if len(targets) == 0 {
+		return DefaultTargetHost
+	}
+
+	if o.TargetAssignment == TargetSticky && userID > 0 {
+		return targets[userID%len(targets)]
+	}
+	n := atomic.AddUint64(&targetCounter, 1) - 1
+	return targets[n%uint64(len(targets))]
+}
+
+func isAssetPath(path string) bool {
+	for _, prefix := range assetPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetTransport sends assets to assetHost, overrides the Host header of
+// requests to targets with host and records stats per route and target into
+// metrics.
+type targetTransport struct {
+	base      http.RoundTripper
+	assetHost string
+	targets   []string
+	host      string
+	metrics   *Metrics
+}
+
+func (t *targetTransport) isTarget(host string) bool {
+	for _, target := range t.targets {
+		if host == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *targetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	toAssetHost := t.assetHost != "" && req.URL.Host != t.assetHost && isAssetPath(req.URL.Path)
+	if toAssetHost || t.host != "" {
+		req = req.Clone(req.Context())
+	}
+	if toAssetHost {
+		req.URL.Host = t.assetHost
+		req.Host = ""
+	}
+	if t.host != "" && t.isTarget(req.URL.Host) {
+		req.Host = t.host
+	}
+
+	startedAt := time.Now()
+	res, err := t.base.RoundTrip(req)
+	elapsed := time.Since(startedAt)
+
+	if t.metrics != nil {
+		t.metrics.Targets.record(req.URL.Host, elapsed, res, err)
+		if route := RouteOf(req); route != nil {
+			t.metrics.Routes.Record(route, elapsed, res, err)
+		}
+	}
+
+	return res, err
+}
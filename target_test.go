@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPickTarget(t *testing.T) {
+	option := Option{TargetHost: "a:80, b:80,,c:80", TargetAssignment: TargetRoundRobin}
+
+	if targets := option.Targets(); strings.Join(targets, ",") != "a:80,b:80,c:80" {
+		t.Fatalf("unexpected targets: %v", targets)
+	}
+
+	seen := map[string]int{}
+	for i := 0; i < 30; i++ {
+		seen[option.pickTarget(1)]++
+	}
+	for _, target := range option.Targets() {
+		if seen[target] != 10 {
+			t.Errorf("round robin, expected(10) != actual(%d) sessions to %s", seen[target], target)
+		}
+	}
+
+	option.TargetAssignment = TargetSticky
+	for userID := 1; userID <= 10; userID++ {
+		target := option.pickTarget(userID)
+		for i := 0; i < 5; i++ {
+			if actual := option.pickTarget(userID); actual != target {
+				t.Errorf("user %d moved from %s to %s", userID, target, actual)
+			}
+		}
+	}
+
+	if err := ValidateTargetAssignment("random"); err == nil {
+		t.Error("unknown assignment is accepted")
+	}
+}
+
+func TestTargetTransport(t *testing.T) {
+	newServer := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	app := newServer("app")
+	assets := newServer("assets")
+
+	option := Option{
+		TargetHost: strings.TrimPrefix(app.URL, "http://"),
+		AssetHost:  strings.TrimPrefix(assets.URL, "http://"),
+		metrics:    NewMetrics(),
+	}
+	ag, err := option.NewAgent(TimeoutDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/", expected: "app"},
+		{path: "/posts/1", expected: "app"},
+		{path: "/image/1.png", expected: "assets"},
+		{path: "/css/style.css", expected: "assets"},
+		{path: "/favicon.ico", expected: "assets"},
+	}
+
+	for _, tc := range testCases {
+		req, err := ag.NewRequest(http.MethodGet, tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := ag.Do(req.Context(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := bufferBody(res)
+		if string(body) != tc.expected {
+			t.Errorf("%s, expected(%s) != actual(%s)", tc.path, tc.expected, body)
+		}
+	}
+
+	if n := targetRequestCount(option.metrics, option.AssetHost); n != 3 {
+		t.Errorf("requests to asset host, expected(3) != actual(%d)", n)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	ThinkNone    = "none"
+	ThinkConst   = "const"
+	ThinkUniform = "uniform"
+	ThinkExp     = "exp"
+)
+
+// ThinkTime is a distribution of pauses between steps of a flow, written as
+// none, const:500ms, uniform:200ms-1s or exp:500ms (mean).
+type ThinkTime struct {
+	Kind string
+	Min  time.Duration
+	Max  time.Duration
+	Mean time.Duration
+}
+
+func ParseThinkTime(spec string) (ThinkTime, error) {
+	kind, value, _ := strings.Cut(strings.TrimSpace(spec), ":")
+
+	switch kind {
+	case "", ThinkNone:
+		return ThinkTime{Kind: ThinkNone}, nil
+	case ThinkConst, ThinkExp:
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return ThinkTime{}, fmt.Errorf("invalid think time %q: duration must be non-negative", spec)
+		}
+		return ThinkTime{Kind: kind, Mean: d}, nil
+	case ThinkUniform:
+		minValue, maxValue, ok := strings.Cut(value, "-")
+		if !ok {
+			return ThinkTime{}, fmt.Errorf("invalid think time %q: uniform:<min>-<max> is expected", spec)
+		}
+		min, errMin := time.ParseDuration(minValue)
+		max, errMax := time.ParseDuration(maxValue)
+		if errMin != nil || errMax != nil || min < 0 || max < min {
+			return ThinkTime{}, fmt.Errorf("invalid think time %q: 0 <= min <= max is expected", spec)
+		}
+		return ThinkTime{Kind: kind, Min: min, Max: max}, nil
+	}
+
+	return ThinkTime{}, fmt.Errorf("invalid think time %q: unknown distribution %q", spec, kind)
+}
+
+func (t ThinkTime) String() string {
+	switch t.Kind {
+	case ThinkConst, ThinkExp:
+		return fmt.Sprintf("%s:%s", t.Kind, t.Mean)
+	case ThinkUniform:
+		return fmt.Sprintf("%s:%s-%s", t.Kind, t.Min, t.Max)
+	}
+	return ThinkNone
+}
+
+// Set implements flag.Value.
+func (t *ThinkTime) Set(spec string) error {
+	parsed, err := ParseThinkTime(spec)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func (t ThinkTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON parses a spec such as "exp:500ms", so that a scenario config
+// with an invalid think time fails to load.
+func (t *ThinkTime) UnmarshalJSON(data []byte) error {
+	var spec string
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return fmt.Errorf("think time must be a string: %w", err)
+	}
+	return t.Set(spec)
+}
+
+func (t ThinkTime) Sample() time.Duration {
+	switch t.Kind {
+	case ThinkConst:
+		return t.Mean
+	case ThinkUniform:
+		return t.Min + time.Duration(rand.Int63n(int64(t.Max-t.Min)+1))
+	case ThinkExp:
+		return time.Duration(rand.ExpFloat64() * float64(t.Mean))
+	}
+	return 0
+}
+
+type thinkTimeKey struct{}
+
+// WithThinkTime overrides the think time of flows running with ctx.
+func WithThinkTime(ctx context.Context, thinkTime ThinkTime) context.Context {
+	return context.WithValue(ctx, thinkTimeKey{}, thinkTime)
+}
+
+// Think pauses between steps of a flow. It returns false when ctx is done.
+func (s *Scenario) Think(ctx context.Context) bool {
+	thinkTime, ok := ctx.Value(thinkTimeKey{}).(ThinkTime)
+	if !ok {
+		thinkTime = s.Option.ThinkTime
+	}
+
+	d := thinkTime.Sample()
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseThinkTime(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected ThinkTime
+		invalid  bool
+	}{
+		{spec: "", expected: ThinkTime{Kind: ThinkNone}},
+		{spec: "none", expected: ThinkTime{Kind: ThinkNone}},
+		{spec: "const:500ms", expected: ThinkTime{Kind: ThinkConst, Mean: 500 * time.Millisecond}},
+		{spec: "exp:1s", expected: ThinkTime{Kind: ThinkExp, Mean: time.Second}},
+		{spec: "uniform:200ms-1s", expected: ThinkTime{Kind: ThinkUniform, Min: 200 * time.Millisecond, Max: time.Second}},
+		{spec: "uniform:1s-200ms", invalid: true},
+		{spec: "uniform:1s", invalid: true},
+		{spec: "const:-1s", invalid: true},
+		{spec: "exp:soon", invalid: true},
+		{spec: "normal:1s", invalid: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			thinkTime, err := ParseThinkTime(tc.spec)
+			if tc.invalid {
+				if err == nil {
+					t.Errorf("invalid spec is accepted: %v", thinkTime)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thinkTime != tc.expected {
+				t.Errorf("expected(%v) != actual(%v)", tc.expected, thinkTime)
+			}
+
+			if reparsed, err := ParseThinkTime(thinkTime.String()); err != nil || reparsed != thinkTime {
+				t.Errorf("%s does not round trip: %v", thinkTime, reparsed)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioConfigThinkTime(t *testing.T) {
+	config, err := LoadScenarioConfig("scenarios/journey.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ThinkTime{Kind: ThinkExp, Mean: 500 * time.Millisecond}
+	if w := config.Workers[0]; w.ThinkTime == nil || *w.ThinkTime != expected {
+		t.Errorf("think time of %s, expected(%v) != actual(%v)", w.Name, expected, w.ThinkTime)
+	}
+
+	for _, spec := range []string{`"exp:soon"`, `500`} {
+		configFile := filepath.Join(t.TempDir(), "config.json")
+		body := `{"workers": [{"name": "w", "flows": {"journey": 1}, "parallelism": 1, "think_time": ` + spec + `}]}`
+		if err := os.WriteFile(configFile, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadScenarioConfig(configFile); err == nil {
+			t.Errorf("think_time %s is accepted", spec)
+		}
+	}
+}
+
+func TestThinkTimeSample(t *testing.T) {
+	uniform := ThinkTime{Kind: ThinkUniform, Min: 200 * time.Millisecond, Max: 300 * time.Millisecond}
+	exp := ThinkTime{Kind: ThinkExp, Mean: 100 * time.Millisecond}
+
+	total := time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		if d := uniform.Sample(); d < uniform.Min || d > uniform.Max {
+			t.Fatalf("%s is out of %s", d, uniform)
+		}
+
+		d := exp.Sample()
+		if d < 0 {
+			t.Fatalf("negative think time: %s", d)
+		}
+		total += d
+	}
+
+	if mean := total / 1000; mean < 70*time.Millisecond || mean > 130*time.Millisecond {
+		t.Errorf("mean of %s is %s", exp, mean)
+	}
+
+	if d := (ThinkTime{Kind: ThinkConst, Mean: time.Second}).Sample(); d != time.Second {
+		t.Errorf("const think time, expected(1s) != actual(%s)", d)
+	}
+	if d := (ThinkTime{}).Sample(); d != 0 {
+		t.Errorf("no think time, expected(0s) != actual(%s)", d)
+	}
+}
+
+func TestThink(t *testing.T) {
+	s := &Scenario{Option: Option{ThinkTime: ThinkTime{Kind: ThinkConst, Mean: time.Hour}}}
+
+	ctx := WithThinkTime(context.Background(), ThinkTime{Kind: ThinkConst, Mean: 10 * time.Millisecond})
+	startedAt := time.Now()
+	if !s.Think(ctx) {
+		t.Error("Think is interrupted")
+	}
+	if elapsed := time.Since(startedAt); elapsed < 10*time.Millisecond || elapsed > time.Second {
+		t.Errorf("worker think time is not used: %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if s.Think(ctx) {
+		t.Error("Think must be interrupted when ctx is done")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caCert, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	targetHost := strings.TrimPrefix(server.URL, "https://")
+
+	testCases := []struct {
+		name         string
+		option       Option
+		expectedHost string
+		failed       bool
+	}{
+		{name: "custom CA", option: Option{CACert: caCert}, expectedHost: targetHost},
+		{name: "unknown CA", option: Option{}, failed: true},
+		{name: "insecure skip verify", option: Option{InsecureSkipVerify: true}, expectedHost: targetHost},
+		// the certificate of httptest is also valid for example.com.
+		{name: "server name", option: Option{CACert: caCert, ServerName: "example.com"}, expectedHost: "example.com"},
+		{name: "wrong server name", option: Option{CACert: caCert, ServerName: "example.org"}, failed: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			option := tc.option
+			option.TargetHost = targetHost
+			option.TargetScheme = SchemeHTTPS
+			if err := option.SetupTransport(); err != nil {
+				t.Fatal(err)
+			}
+
+			ag, err := option.NewAgent(TimeoutDefault)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := ag.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := ag.Do(req.Context(), req)
+			if tc.failed {
+				if err == nil {
+					t.Error("request is expected to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, _ := bufferBody(res)
+			if string(body) != tc.expectedHost {
+				t.Errorf("expected(%s) != actual(%s)", tc.expectedHost, body)
+			}
+		})
+	}
+
+	option := Option{TargetScheme: "ftp"}
+	if err := option.SetupTransport(); err == nil {
+		t.Error("unknown scheme is accepted")
+	}
+	option = Option{TargetScheme: SchemeHTTPS, CACert: filepath.Join(t.TempDir(), "missing.pem")}
+	if err := option.SetupTransport(); err == nil {
+		t.Error("missing CA certificate is accepted")
+	}
+}
+
+func TestSetupTransportServerNameOnlyForTargets(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.TLS.ServerName))
+	})
+	target := httptest.NewTLSServer(handler)
+	defer target.Close()
+	assets := httptest.NewTLSServer(handler)
+	defer assets.Close()
+
+	// both servers share the certificate of httptest.
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: target.Certificate().Raw})
+	if err := os.WriteFile(caCert, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	assetHost := strings.TrimPrefix(assets.URL, "https://")
+
+	option := Option{
+		TargetHost:   strings.TrimPrefix(target.URL, "https://"),
+		TargetScheme: SchemeHTTPS,
+		AssetHost:    assetHost,
+		CACert:       caCert,
+		ServerName:   "example.com",
+	}
+	if err := option.SetupTransport(); err != nil {
+		t.Fatal(err)
+	}
+	ag, err := option.NewAgent(TimeoutDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/", expected: "example.com example.com"},
+		// IP addresses are never sent as SNI.
+		{path: "/favicon.ico", expected: assetHost + " "},
+	}
+
+	for _, tc := range testCases {
+		req, err := ag.NewRequest(http.MethodGet, tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := ag.Do(req.Context(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := bufferBody(res)
+		if string(body) != tc.expected {
+			t.Errorf("%s, expected(%s) != actual(%s)", tc.path, tc.expected, body)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/isucon/isucandar/agent"
+)
+
+const (
+	DefaultTraceBodyLimit = 64 * 1024
+	// entries keep up to 2 bodies of DefaultTraceBodyLimit each.
+	DefaultTraceMaxEntries = 2000
+)
+
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+
+	Agent    int64    `json:"_agent"`
+	Failures []string `json:"_failures,omitempty"`
+
+	mu       sync.Mutex
+	recorded bool
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	Cookies     []HARNameValue `json:"cookies"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARPostData struct {
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text"`
+	Encoding  string `json:"_encoding,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Tracer keeps up to MaxEntries entries in memory until WriteHAR, and counts
+// the entries dropped after that.
+type Tracer struct {
+	mu      sync.Mutex
+	entries []*HAREntry
+	dropped int64
+
+	FailuresOnly bool
+	BodyLimit    int
+	MaxEntries   int
+
+	agents int64
+}
+
+func NewTracer(failuresOnly bool, bodyLimit int, maxEntries int) *Tracer {
+	return &Tracer{
+		entries:      []*HAREntry{},
+		FailuresOnly: failuresOnly,
+		BodyLimit:    bodyLimit,
+		MaxEntries:   maxEntries,
+	}
+}
+
+func (t *Tracer) Wrap(ag *agent.Agent) {
+	ag.HttpClient.Transport = &traceTransport{
+		tracer:  t,
+		base:    ag.HttpClient.Transport,
+		agentID: atomic.AddInt64(&t.agents, 1),
+	}
+}
+
+func (t *Tracer) record(entry *HAREntry) {
+	entry.mu.Lock()
+	recorded := entry.recorded
+	entry.recorded = true
+	entry.mu.Unlock()
+
+	if recorded {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.MaxEntries > 0 && len(t.entries) >= t.MaxEntries {
+		t.dropped++
+		return
+	}
+	t.entries = append(t.entries, entry)
+}
+
+func (t *Tracer) Dropped() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+func (t *Tracer) Entries() []*HAREntry {
+	t.mu.Lock()
+	entries := append([]*HAREntry{}, t.entries...)
+	t.mu.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+	return entries
+}
+
+func (t *Tracer) WriteHAR(harFile string) error {
+	har := HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "ISUCON_BON", Version: "1.0"},
+			Entries: t.Entries(),
+		},
+	}
+
+	file, err := os.Create(harFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(har)
+}
+
+type traceEntryKey struct{}
+
+func MarkTraceFailure(res *http.Response, errs []error) {
+	if res == nil || res.Request == nil {
+		return
+	}
+
+	holder, ok := res.Request.Context().Value(traceEntryKey{}).(*traceHolder)
+	if !ok {
+		return
+	}
+
+	holder.entry.mu.Lock()
+	for _, err := range errs {
+		holder.entry.Failures = append(holder.entry.Failures, fmt.Sprintf("%v", err))
+	}
+	holder.entry.mu.Unlock()
+
+	holder.tracer.record(holder.entry)
+}
+
+type traceHolder struct {
+	tracer *Tracer
+	entry  *HAREntry
+}
+
+type traceTransport struct {
+	tracer  *Tracer
+	base    http.RoundTripper
+	agentID int64
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := &HAREntry{
+		StartedDateTime: time.Now(),
+		Agent:           t.agentID,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+			QueryString: []HARNameValue{},
+			Cookies:     []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, HARNameValue{Name: name, Value: value})
+		}
+	}
+	for _, cookie := range req.Cookies() {
+		entry.Request.Cookies = append(entry.Request.Cookies, HARNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		text, encoding, truncated := harBody(body, t.tracer.BodyLimit)
+		entry.Request.BodySize = int64(len(body))
+		entry.Request.PostData = &HARPostData{
+			MimeType:  req.Header.Get("Content-Type"),
+			Text:      text,
+			Encoding:  encoding,
+			Truncated: truncated,
+		}
+	}
+
+	res, err := t.base.RoundTrip(req)
+	wait := time.Since(entry.StartedDateTime)
+	entry.Timings.Wait = milliseconds(wait)
+	entry.Time = milliseconds(wait)
+
+	if err != nil {
+		entry.Failures = append(entry.Failures, err.Error())
+		t.tracer.record(entry)
+		return nil, err
+	}
+
+	entry.Response = HARResponse{
+		Status:      res.StatusCode,
+		StatusText:  http.StatusText(res.StatusCode),
+		HTTPVersion: res.Proto,
+		Headers:     harHeaders(res.Header),
+		Cookies:     []HARNameValue{},
+		Content:     HARContent{MimeType: res.Header.Get("Content-Type")},
+		RedirectURL: res.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	for _, cookie := range res.Cookies() {
+		entry.Response.Cookies = append(entry.Response.Cookies, HARNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	res.Body = &traceBody{
+		ReadCloser: res.Body,
+		tracer:     t.tracer,
+		entry:      entry,
+		receivedAt: time.Now(),
+	}
+
+	holder := &traceHolder{tracer: t.tracer, entry: entry}
+	res.Request = req.WithContext(context.WithValue(req.Context(), traceEntryKey{}, holder))
+
+	if !t.tracer.FailuresOnly {
+		t.tracer.record(entry)
+	}
+
+	return res, nil
+}
+
+type traceBody struct {
+	io.ReadCloser
+	tracer     *Tracer
+	entry      *HAREntry
+	receivedAt time.Time
+	buf        bytes.Buffer
+	size       int64
+	once       sync.Once
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if rest := b.tracer.BodyLimit + 1 - b.buf.Len(); rest > 0 {
+		if rest > n {
+			rest = n
+		}
+		b.buf.Write(p[:rest])
+	}
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	b.once.Do(func() {
+		receive := time.Since(b.receivedAt)
+		text, encoding, truncated := harBody(b.buf.Bytes(), b.tracer.BodyLimit)
+
+		b.entry.mu.Lock()
+		b.entry.Timings.Receive = milliseconds(receive)
+		b.entry.Time += milliseconds(receive)
+		b.entry.Response.BodySize = b.size
+		b.entry.Response.Content.Size = b.size
+		b.entry.Response.Content.Text = text
+		b.entry.Response.Content.Encoding = encoding
+		b.entry.Response.Content.Truncated = truncated
+		b.entry.mu.Unlock()
+	})
+	return b.ReadCloser.Close()
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	headers := []HARNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Name < headers[j].Name
+	})
+	return headers
+}
+
+func harBody(body []byte, limit int) (string, string, bool) {
+	truncated := false
+	if limit >= 0 && len(body) > limit {
+		body = body[:limit]
+		truncated = true
+	}
+
+	if utf8.Valid(body) {
+		return string(body), "", truncated
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64", truncated
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/isucon/isucandar/agent"
+)
+
+func newTracedAgent(t *testing.T, targetHost string, tracer *Tracer) *agent.Agent {
+	t.Helper()
+
+	option := Option{TargetHost: targetHost, RequestTimeout: DefaultRequestTimeout, tracer: tracer}
+	ag, err := option.NewAgent(TimeoutDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ag
+}
+
+func TestTracer(t *testing.T) {
+	server := NewMockServer(NewMockFixture(3, 4, 8), MockOptions{}).Start(t)
+	tracer := NewTracer(false, DefaultTraceBodyLimit, 0)
+	ag := newTracedAgent(t, strings.TrimPrefix(server.URL, "http://"), tracer)
+
+	values := url.Values{"account_name": {"user01"}, "password": {"user01user01"}}
+	res, err := PostLoginAction(context.Background(), ag, "user01", "user01user01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = GetRootAction(context.Background(), ag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	entries := tracer.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("entries, expected(2) != actual(%d)", len(entries))
+	}
+
+	login := entries[0]
+	if login.Request.Method != http.MethodPost || login.Response.Status != http.StatusFound {
+		t.Errorf("login, expected(POST 302) != actual(%s %d)", login.Request.Method, login.Response.Status)
+	}
+	if login.Request.PostData == nil || login.Request.PostData.Text != values.Encode() {
+		t.Errorf("login body is not recorded: %+v", login.Request.PostData)
+	}
+
+	index := entries[1]
+	if index.Response.Status != http.StatusOK || index.Response.Content.Text != string(body) {
+		t.Errorf("index response is not recorded: %d", index.Response.Status)
+	}
+	if index.Response.Content.Size != int64(len(body)) || index.Response.BodySize != int64(len(body)) {
+		t.Errorf("size, expected(%d) != actual(%d)", len(body), index.Response.Content.Size)
+	}
+	if index.Timings.Wait <= 0 || index.Time < index.Timings.Wait+index.Timings.Receive {
+		t.Errorf("invalid timings: %+v, time: %v", index.Timings, index.Time)
+	}
+	if index.Agent != login.Agent {
+		t.Errorf("agent, expected(%d) != actual(%d)", login.Agent, index.Agent)
+	}
+	if len(index.Request.Cookies) == 0 {
+		t.Error("session cookie is not recorded")
+	}
+
+	harFile := filepath.Join(t.TempDir(), "trace.har")
+	if err := tracer.WriteHAR(harFile); err != nil {
+		t.Fatal(err)
+	}
+	har, err := LoadHAR(harFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("unexpected HAR: version %s, %d entries", har.Log.Version, len(har.Log.Entries))
+	}
+	if loaded := har.Log.Entries[1]; loaded.Request.URL != index.Request.URL || loaded.Response.Content.Text != index.Response.Content.Text {
+		t.Errorf("entry, expected(%s) != actual(%s)", index.Request.URL, loaded.Request.URL)
+	}
+}
+
+func TestTracerFailuresOnly(t *testing.T) {
+	server := NewMockServer(NewMockFixture(3, 4, 8), MockOptions{}).Start(t)
+	tracer := NewTracer(true, DefaultTraceBodyLimit, 0)
+	ag := newTracedAgent(t, strings.TrimPrefix(server.URL, "http://"), tracer)
+
+	res, err := GetLoginAction(context.Background(), ag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validation := RouteGetLogin.Validate(res); !validation.IsEmpty() {
+		t.Fatal(validation)
+	}
+	if n := len(tracer.Entries()); n != 0 {
+		t.Fatalf("successful request is recorded: %d entries", n)
+	}
+
+	res, err = GetRootAction(context.Background(), ag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validation := ValidateResponse(res, WithStatusCode(http.StatusInternalServerError)); validation.IsEmpty() {
+		t.Fatal("status code is not validated")
+	}
+
+	entries := tracer.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("entries, expected(1) != actual(%d)", len(entries))
+	}
+	if len(entries[0].Failures) != 1 || !strings.Contains(entries[0].Failures[0], "500") {
+		t.Errorf("failures are not recorded: %v", entries[0].Failures)
+	}
+	if entries[0].Response.Content.Text == "" {
+		t.Error("body of failed response is not recorded")
+	}
+}
+
+func TestTracerTransportError(t *testing.T) {
+	server := NewMockServer(NewMockFixture(3, 4, 8), MockOptions{}).Start(t)
+	targetHost := strings.TrimPrefix(server.URL, "http://")
+	server.Close()
+
+	tracer := NewTracer(true, DefaultTraceBodyLimit, 0)
+	ag := newTracedAgent(t, targetHost, tracer)
+
+	if _, err := GetRootAction(context.Background(), ag); err == nil {
+		t.Fatal("request to closed server succeeded")
+	}
+
+	entries := tracer.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("entries, expected(1) != actual(%d)", len(entries))
+	}
+	if entries[0].Response.Status != 0 || len(entries[0].Failures) == 0 {
+		t.Errorf("transport error is not recorded: status %d, failures %v", entries[0].Response.Status, entries[0].Failures)
+	}
+}
+
+func TestTracerMaxEntries(t *testing.T) {
+	server := NewMockServer(NewMockFixture(3, 4, 8), MockOptions{}).Start(t)
+	tracer := NewTracer(false, DefaultTraceBodyLimit, 2)
+	ag := newTracedAgent(t, strings.TrimPrefix(server.URL, "http://"), tracer)
+
+	for i := 0; i < 5; i++ {
+		res, err := GetLoginAction(context.Background(), ag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	if n := len(tracer.Entries()); n != 2 {
+		t.Errorf("entries, expected(2) != actual(%d)", n)
+	}
+	if n := tracer.Dropped(); n != 3 {
+		t.Errorf("dropped, expected(3) != actual(%d)", n)
+	}
+}
+
+func TestHARBody(t *testing.T) {
+	testCases := []struct {
+		name      string
+		body      []byte
+		limit     int
+		text      string
+		encoding  string
+		truncated bool
+	}{
+		{name: "text", body: []byte("こんにちは"), limit: 64, text: "こんにちは"},
+		{name: "truncated", body: []byte("0123456789"), limit: 4, text: "0123", truncated: true},
+		{name: "binary", body: []byte{0x89, 'P', 'N', 'G'}, limit: 64, text: "iVBORw==", encoding: "base64"},
+		// a multi-byte character cut at the limit is no longer valid UTF-8.
+		{name: "truncated in character", body: []byte("あい"), limit: 4, text: "44GC4w==", encoding: "base64", truncated: true},
+		{name: "no limit", body: []byte("0123456789"), limit: -1, text: "0123456789"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			text, encoding, truncated := harBody(tc.body, tc.limit)
+			if text != tc.text || encoding != tc.encoding || truncated != tc.truncated {
+				t.Errorf("expected(%q %q %v) != actual(%q %q %v)", tc.text, tc.encoding, tc.truncated, text, encoding, truncated)
+			}
+		})
+	}
+}
+
+func TestMarkTraceFailureWithoutTrace(t *testing.T) {
+	// responses of agents without a tracer are left as they are.
+	MarkTraceFailure(nil, []error{errors.New("failure")})
+	MarkTraceFailure(&http.Response{Request: &http.Request{}}, []error{errors.New("failure")})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/isucon/isucandar/agent"
+)
+
+// SetupTransport builds the transport cloned by every agent from the scheme,
+// TLS and connection settings of Option.
+func (o *Option) SetupTransport() error {
+	transport := agent.DefaultTransport.Clone()
+
+	switch o.scheme() {
+	case SchemeHTTP:
+	case SchemeHTTPS:
+		tlsConfig, err := o.newTLSConfig()
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = tlsConfig
+	default:
+		return fmt.Errorf("unknown target scheme %q: %s or %s is expected", o.TargetScheme, SchemeHTTP, SchemeHTTPS)
+	}
+
+	if o.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	transport.MaxConnsPerHost = o.MaxConnsPerHost
+	transport.IdleConnTimeout = o.IdleConnTimeout
+
+	if o.metrics != nil {
+		transport.Dial = nil
+		transport.DialContext = countingDialContext(o.metrics.Connections, agent.DefaultDialer.DialContext)
+	}
+	if o.scheme() == SchemeHTTPS && o.ServerName != "" {
+		if !o.DisableHTTP2 {
+			// a custom TLS dialer has to offer h2 on its own.
+			transport.TLSClientConfig.NextProtos = []string{"h2", "http/1.1"}
+		}
+		transport.DialTLSContext = o.dialTLSContext(transport.TLSClientConfig, transport.DialContext)
+	}
+
+	o.transport = transport
+	return nil
+}
+
+func (o Option) baseTransport() *http.Transport {
+	if o.transport != nil {
+		return o.transport
+	}
+	return agent.DefaultTransport
+}
+
+// applyKeepAlive disables keep-alive of ag with DisableKeepAliveRate, so the
+// agent opens a new connection for every request.
+func (o Option) applyKeepAlive(ag *agent.Agent) {
+	if o.DisableKeepAliveRate <= 0 || rand.Float64() >= o.DisableKeepAliveRate {
+		return
+	}
+	if transport, ok := ag.HttpClient.Transport.(*http.Transport); ok {
+		transport.DisableKeepAlives = true
+	}
+}
+
+func countingDialContext(metrics *connectionMetrics, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		metrics.Dial(addr, err)
+		return conn, err
+	}
+}
+
+type connectionMetrics struct {
+	mu     sync.Mutex
+	opened map[string]int64
+	errors int64
+}
+
+func (m *connectionMetrics) Dial(addr string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.errors++
+		return
+	}
+	m.opened[addr]++
+}
+
+func (m *connectionMetrics) Opened(addr string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.opened[addr]
+}
+
+func (m *connectionMetrics) Report() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	addrs := make([]string, 0, len(m.opened))
+	total := int64(0)
+	for addr, opened := range m.opened {
+		addrs = append(addrs, addr)
+		total += opened
+	}
+	sort.Strings(addrs)
+
+	lines := []string{fmt.Sprintf("connections opened=%d dial-errors=%d", total, m.errors)}
+	for _, addr := range addrs {
+		lines = append(lines, fmt.Sprintf("connections %s opened=%d", addr, m.opened[addr]))
+	}
+	return lines
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransportSettings(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	targetHost := strings.TrimPrefix(server.URL, "https://")
+
+	testCases := []struct {
+		name          string
+		option        Option
+		expectedProto string
+		expectedConns int64
+	}{
+		{name: "default", expectedProto: "HTTP/2.0", expectedConns: 1},
+		{name: "http/1.1", option: Option{DisableHTTP2: true}, expectedProto: "HTTP/1.1", expectedConns: 1},
+		{name: "no keep-alive", option: Option{DisableHTTP2: true, DisableKeepAliveRate: 1}, expectedProto: "HTTP/1.1", expectedConns: 5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			option := tc.option
+			option.TargetHost = targetHost
+			option.TargetScheme = SchemeHTTPS
+			option.InsecureSkipVerify = true
+			option.metrics = NewMetrics()
+			if err := option.SetupTransport(); err != nil {
+				t.Fatal(err)
+			}
+
+			ag, err := option.NewAgent(TimeoutDefault)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 5; i++ {
+				req, err := ag.NewRequest(http.MethodGet, "/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				res, err := ag.Do(req.Context(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := bufferBody(res)
+				if string(body) != tc.expectedProto {
+					t.Errorf("protocol, expected(%s) != actual(%s)", tc.expectedProto, body)
+				}
+			}
+
+			if n := option.metrics.Connections.Opened(targetHost); n != tc.expectedConns {
+				t.Errorf("connections, expected(%d) != actual(%d)", tc.expectedConns, n)
+			}
+		})
+	}
+}
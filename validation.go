@@ -10,6 +10,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +29,19 @@ const (
 	ErrCSRFToken         failure.StringCode = "csrf-token"
 	ErrInvalidPostOrder  failure.StringCode = "post-order"
 	ErrInvalidAsset      failure.StringCode = "asset"
+	ErrInvalidUserPage   failure.StringCode = "user-page"
+	ErrInvalidPost       failure.StringCode = "post"
+	ErrInvalidComment    failure.StringCode = "comment"
+	ErrInvalidCreatedAt  failure.StringCode = "created-at"
+	ErrStaleContent      failure.StringCode = "stale-content"
+	ErrSessionMismatch   failure.StringCode = "session"
+	ErrBodyTooLarge      failure.StringCode = "body-too-large"
+	ErrAnonymousPage     failure.StringCode = "anonymous-page"
+)
+
+const (
+	LatestCommentsOnIndex = 3
+	MaxResponseBodySize   = 8 * 1024 * 1024
 )
 
 type ValidationError struct {
@@ -58,28 +73,86 @@ func (v ValidationError) IsEmpty() bool {
 	return true
 }
 
-func (v ValidationError) Add(step *isucandar.BenchmarkStep) {
+func (v ValidationError) IsOnly(code failure.Code) bool {
+	for _, err := range v.Errors {
+		if err != nil {
+			if ve, ok := err.(ValidationError); ok {
+				if !ve.IsOnly(code) {
+					return false
+				}
+			} else if !failure.IsCode(err, code) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (v ValidationError) All() []error {
+	errs := []error{}
 	for _, err := range v.Errors {
 		if err != nil {
 			if ve, ok := err.(ValidationError); ok {
-				ve.Add(step)
+				errs = append(errs, ve.All()...)
 			} else {
-				step.AddError(err)
+				errs = append(errs, err)
 			}
 		}
 	}
+	return errs
+}
+
+func (v ValidationError) Add(step *isucandar.BenchmarkStep) {
+	for _, err := range v.All() {
+		step.AddError(err)
+	}
 }
 
 type ResponseValidator func(*http.Response) error
 
 func ValidateResponse(res *http.Response, validators ...ResponseValidator) ValidationError {
 	errs := []error{}
-	for _, validator := range validators {
-		if err := validator(res); err != nil {
-			errs = append(errs, err)
+	body, err := bufferBody(res)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, validator := range validators {
+			if body != nil {
+				res.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			if err := validator(res); err != nil {
+				errs = append(errs, err)
+			}
 		}
+		if body != nil {
+			res.Body = io.NopCloser(bytes.NewReader(body))
+		}
+	}
+
+	validation := ValidationError{Errors: errs}
+	if !validation.IsEmpty() {
+		MarkTraceFailure(res, errs)
 	}
-	return ValidationError{Errors: errs}
+
+	return validation
+}
+
+// bufferBody reads the whole body once so that every validator can read it from the beginning.
+func bufferBody(r *http.Response) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxResponseBodySize+1))
+	if err != nil {
+		return nil, failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %w", endpoint(r), err))
+	}
+	if len(body) > MaxResponseBodySize {
+		return nil, failure.NewError(ErrBodyTooLarge, fmt.Errorf("%s : body is larger than %d bytes", endpoint(r), MaxResponseBodySize))
+	}
+
+	return body, nil
 }
 
 func WithStatusCode(statusCode int) ResponseValidator {
@@ -87,7 +160,7 @@ func WithStatusCode(statusCode int) ResponseValidator {
 		if r.StatusCode != statusCode {
 			return failure.NewError(
 				ErrInvalidStatusCode,
-				fmt.Errorf("%s %s : expected(%d) != actual(%d)", r.Request.Method, r.Request.URL.Path, statusCode, r.StatusCode),
+				fmt.Errorf("%s : expected(%d) != actual(%d)", endpoint(r), statusCode, r.StatusCode),
 			)
 		}
 		return nil
@@ -100,11 +173,11 @@ func WithIncludeBody(val string) ResponseValidator {
 
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s %s : %s", r.Request.Method, r.Request.URL.Path, err.Error()))
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
 		}
 
-		if bytes.IndexAny(body, val) == -1 {
-			return failure.NewError(ErrNotFound, fmt.Errorf("%s %s : %s is not found in body", r.Request.Method, r.Request.URL.Path, val))
+		if !bytes.Contains(body, []byte(val)) {
+			return failure.NewError(ErrNotFound, fmt.Errorf("%s : %s is not found in body", endpoint(r), val))
 		}
 
 		return nil
@@ -119,73 +192,432 @@ func WithCSRFToken(user *User) ResponseValidator {
 
 		doc, err := goquery.NewDocumentFromReader(r.Body)
 		if err != nil {
-			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s %s : %s", r.Request.Method, r.Request.URL.Path, err.Error()))
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
 		}
 
-		node := doc.Find(`input[name="csrf_token"]`).Get(0)
-		if node == nil {
-			return failure.NewError(ErrCSRFToken, fmt.Errorf("%s %s : CSRF token is not found", r.Request.Method, r.Request.URL.Path))
+		if token, ok := doc.Find(`input[name="csrf_token"]`).First().Attr("value"); ok {
+			user.SetCSRFToken(token)
 		}
 
-		for _, attr := range node.Attr {
-			if attr.Key == "value" {
-				user.SetCSRFToken(attr.Val)
-			}
+		if user.GetCSRFToken() == "" {
+			return failure.NewError(ErrCSRFToken, fmt.Errorf("%s : CSRF token is not found", endpoint(r)))
 		}
 
-		if user.GetCSRFToken() == "" {
-			return failure.NewError(ErrCSRFToken, fmt.Errorf("%s %s : CSRF token is not found", r.Request.Method, r.Request.URL.Path))
+		return nil
+	}
+}
+
+func WithLoggedInUser(user *User) ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		accountName := strings.TrimSpace(doc.Find(".isu-account-name").First().Text())
+		if accountName != user.AccountName {
+			return failure.NewError(ErrSessionMismatch, fmt.Errorf("%s : logged in user, expected(%s) != actual(%s)", endpoint(r), user.AccountName, accountName))
 		}
 
 		return nil
 	}
 }
 
-func WithOrderedPosts() ResponseValidator {
+func WithIndexPosts(users *UserSet, posts *PostSet) ResponseValidator {
 	return func(r *http.Response) error {
 		defer r.Body.Close()
 
 		doc, err := goquery.NewDocumentFromReader(r.Body)
 		if err != nil {
-			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s %s : %s", r.Request.Method, r.Request.URL.Path, err.Error()))
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
 		}
 
 		errs := []error{}
 
 		previousCreatedAt := time.Now()
 		doc.Find(".isu-posts .isu-post").Each(func(_ int, s *goquery.Selection) {
-			post := s.First()
-			idAttr, exists := post.Attr("id")
-			if !exists {
+			idAttr, _ := s.Attr("id")
+			id, err := strconv.Atoi(strings.TrimPrefix(idAttr, "pid_"))
+			if err != nil || !strings.HasPrefix(idAttr, "pid_") {
+				errs = append(errs, failure.NewError(ErrInvalidPost, fmt.Errorf("%s : invalid post id: %q", endpoint(r), idAttr)))
 				return
 			}
-			createdAtAttr, exists := post.Attr("data-created-at")
-			if !exists {
+
+			createdAtAttr, _ := s.Attr("data-created-at")
+			createdAt, err := time.Parse(time.RFC3339, createdAtAttr)
+			if err != nil {
+				errs = append(errs, failure.NewError(ErrInvalidCreatedAt, fmt.Errorf("%s : invalid created at of post %d: %q", endpoint(r), id, createdAtAttr)))
 				return
 			}
 
-			id, _ := strconv.Atoi(strings.TrimPrefix(idAttr, "pid_"))
-			createdAt, _ := time.Parse(time.RFC3339, createdAtAttr)
-
 			if createdAt.After(previousCreatedAt) {
-				errs = append(errs, failure.NewError(ErrInvalidPostOrder, fmt.Errorf("%s %s : invalid order in top page: %s", r.Request.Method, r.Request.URL.Path, createdAt)))
+				errs = append(errs, failure.NewError(ErrInvalidPostOrder, fmt.Errorf("%s : invalid order in top page: %s", endpoint(r), createdAt)))
 				AdminLogger.Printf("isu-post: %d: %s", id, createdAt)
 			}
+			previousCreatedAt = createdAt
+
+			post, ok := posts.Get(id)
+			if !ok {
+				return
+			}
+			user, ok := users.Get(post.UserID)
+			if !ok {
+				return
+			}
+
+			if user.DeleteFlag != 0 {
+				errs = append(errs, failure.NewError(ErrInvalidPost, fmt.Errorf("%s : post %d of deleted user is displayed", endpoint(r), post.ID)))
+				return
+			}
+
+			errs = append(errs, validatePostNode(r, s, post, user)...)
+			errs = append(errs, validateLatestComments(r, s, post, users)...)
+		})
+
+		return ValidationError{Errors: errs}
+	}
+}
+
+func WithFreshPost(post *Post) ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		nodes := doc.Find(".isu-posts .isu-post")
+		if nodes.Filter(fmt.Sprintf("#pid_%d", post.ID)).Length() > 0 {
+			return nil
+		}
+
+		// the post may already be pushed out of the page by newer posts.
+		if nodes.Length() > 0 {
+			createdAtAttr, _ := nodes.Last().Attr("data-created-at")
+			if createdAt, err := time.Parse(time.RFC3339, createdAtAttr); err == nil && createdAt.After(post.CreatedAt) {
+				return nil
+			}
+		}
+
+		return failure.NewError(ErrStaleContent, fmt.Errorf("%s : post %d is not found", endpoint(r), post.ID))
+	}
+}
+
+func WithUserPage(user *User, posts ...*Post) ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		accountName := doc.Find(".isu-user-account-name").First().Text()
+		if !strings.Contains(accountName, user.AccountName) {
+			return failure.NewError(ErrInvalidUserPage, fmt.Errorf("%s : account name, expected(%s) != actual(%s)", endpoint(r), user.AccountName, strings.TrimSpace(accountName)))
+		}
+
+		errs := []error{}
+		for _, post := range posts {
+			if doc.Find(fmt.Sprintf("#pid_%d", post.ID)).Length() == 0 {
+				errs = append(errs, failure.NewError(ErrInvalidUserPage, fmt.Errorf("%s : post %d is not found", endpoint(r), post.ID)))
+			}
+		}
+
+		return ValidationError{Errors: errs}
+	}
+}
+
+func WithPost(post *Post, user *User, comments ...*Comment) ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		node := doc.Find(fmt.Sprintf("#pid_%d", post.ID)).First()
+		if node.Length() == 0 {
+			return failure.NewError(ErrInvalidPost, fmt.Errorf("%s : post %d is not found", endpoint(r), post.ID))
+		}
+
+		errs := validatePostNode(r, node, post, user)
+
+		commentTexts := map[string]bool{}
+		node.Find(".isu-comment-text").Each(func(_ int, s *goquery.Selection) {
+			commentTexts[strings.TrimSpace(s.Text())] = true
+		})
+		for _, comment := range comments {
+			if !commentTexts[strings.TrimSpace(comment.Comment)] {
+				errs = append(errs, failure.NewError(ErrInvalidComment, fmt.Errorf("%s : comment %d is not found in post %d", endpoint(r), comment.ID, post.ID)))
+			}
+		}
+
+		return ValidationError{Errors: errs}
+	}
+}
+
+// WithInitialPosts checks that every post on the page and its comment count
+// come from the dump, so posts and comments left by a previous run fail.
+// Pages of a single post render all comments, the others the latest ones.
+func WithInitialPosts(posts *PostSet, maxPostID int, allComments bool) ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		errs := []error{}
+		doc.Find(".isu-posts .isu-post").Each(func(_ int, s *goquery.Selection) {
+			idAttr, _ := s.Attr("id")
+			id, err := strconv.Atoi(strings.TrimPrefix(idAttr, "pid_"))
+			if err != nil {
+				errs = append(errs, failure.NewError(ErrInvalidPost, fmt.Errorf("%s : invalid post id: %q", endpoint(r), idAttr)))
+				return
+			}
+
+			post, ok := posts.Get(id)
+			if !ok || id > maxPostID {
+				errs = append(errs, failure.NewError(ErrInitialData, fmt.Errorf("%s : post %d is not in the dump", endpoint(r), id)))
+				return
+			}
+
+			expected := len(post.Comments())
+			countText := strings.TrimSpace(s.Find(".isu-post-comment-count b").First().Text())
+			if count, err := strconv.Atoi(countText); err != nil || count != expected {
+				errs = append(errs, failure.NewError(ErrInitialData, fmt.Errorf("%s : comment count of post %d, expected(%d) != actual(%q)", endpoint(r), id, expected, countText)))
+			}
+
+			if !allComments && expected > LatestCommentsOnIndex {
+				expected = LatestCommentsOnIndex
+			}
+			if n := s.Find(".isu-comment").Length(); n != expected {
+				errs = append(errs, failure.NewError(ErrInitialData, fmt.Errorf("%s : comments of post %d, expected(%d) != actual(%d)", endpoint(r), id, expected, n)))
+			}
 		})
 
 		return ValidationError{Errors: errs}
 	}
 }
 
+func WithAnonymousPage() ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		errs := []error{}
+		if doc.Find(".isu-account-name").Length() > 0 {
+			errs = append(errs, failure.NewError(ErrAnonymousPage, fmt.Errorf("%s : logged in user is displayed to anonymous visitor", endpoint(r))))
+		}
+		if doc.Find(`input[name="csrf_token"]`).Length() > 0 {
+			errs = append(errs, failure.NewError(ErrAnonymousPage, fmt.Errorf("%s : CSRF token is displayed to anonymous visitor", endpoint(r))))
+		}
+		if doc.Find(`form[action="/"], form[action="/comment"]`).Length() > 0 {
+			errs = append(errs, failure.NewError(ErrAnonymousPage, fmt.Errorf("%s : post form is displayed to anonymous visitor", endpoint(r))))
+		}
+
+		return ValidationError{Errors: errs}
+	}
+}
+
+func WithPostIDs(ids *[]int) ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		*ids = []int{}
+		doc.Find(".isu-posts .isu-post").Each(func(_ int, s *goquery.Selection) {
+			idAttr, _ := s.Attr("id")
+			if id, err := strconv.Atoi(strings.TrimPrefix(idAttr, "pid_")); err == nil {
+				*ids = append(*ids, id)
+			}
+		})
+
+		return nil
+	}
+}
+
 func WithLocation(val string) ResponseValidator {
 	return func(r *http.Response) error {
 		target := r.Request.URL.ResolveReference(&url.URL{Path: val})
-		if r.Header.Get("Location") != target.String() {
+		location, err := r.Location()
+		if err != nil || location.String() != target.String() {
+			return failure.NewError(
+				ErrInvalidPath,
+				fmt.Errorf("%s : %s, expected(%s) != actual(%s)", endpoint(r), "Location", val, r.Header.Get("Location")),
+			)
+		}
+		return nil
+	}
+}
+
+func validatePostNode(r *http.Response, node *goquery.Selection, post *Post, user *User) []error {
+	errs := []error{}
+
+	accountName := strings.TrimSpace(node.Find(".isu-post-account-name").First().Text())
+	if accountName != user.AccountName {
+		errs = append(errs, failure.NewError(ErrInvalidPost, fmt.Errorf("%s : author of post %d, expected(%s) != actual(%s)", endpoint(r), post.ID, user.AccountName, accountName)))
+	}
+
+	if !strings.Contains(node.Find(".isu-post-text").Text(), post.Body) {
+		errs = append(errs, failure.NewError(ErrInvalidPost, fmt.Errorf("%s : body of post %d is not found", endpoint(r), post.ID)))
+	}
+
+	src, _ := node.Find(".isu-post-image img").First().Attr("src")
+	if src != post.ImageURL() {
+		errs = append(errs, failure.NewError(ErrInvalidPost, fmt.Errorf("%s : image of post %d, expected(%s) != actual(%s)", endpoint(r), post.ID, post.ImageURL(), src)))
+	}
+
+	return errs
+}
+
+func validateLatestComments(r *http.Response, node *goquery.Selection, post *Post, users *UserSet) []error {
+	errs := []error{}
+	comments := post.Comments()
+
+	// comments tracked after the request was sent, still in flight, or whose
+	// request failed may or may not be rendered.
+	settled := 0
+	startedAt, ok := RequestStartedAt(r.Request)
+	for _, comment := range comments {
+		if !comment.IsCreatedInLoad() || (ok && comment.trackedAt.Before(startedAt)) {
+			settled++
+		}
+	}
+	unconfirmed, pending := post.UncertainComments()
+	uncertain := len(comments) - settled + len(unconfirmed) + pending
+
+	countText := strings.TrimSpace(node.Find(".isu-post-comment-count b").First().Text())
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return append(errs, failure.NewError(ErrInvalidComment, fmt.Errorf("%s : invalid comment count of post %d: %q", endpoint(r), post.ID, countText)))
+	}
+	if uncertain == 0 && count != settled {
+		errs = append(errs, failure.NewError(ErrInvalidComment, fmt.Errorf("%s : comment count of post %d, expected(%d) != actual(%d)", endpoint(r), post.ID, settled, count)))
+	}
+	if uncertain > 0 && (count < settled || count > settled+uncertain) {
+		errs = append(errs, failure.NewError(ErrInvalidComment, fmt.Errorf("%s : comment count of post %d, expected(%d-%d) != actual(%d)", endpoint(r), post.ID, settled, settled+uncertain, count)))
+	}
+
+	expected := count
+	if uncertain == 0 {
+		expected = len(comments)
+	}
+	if expected > LatestCommentsOnIndex {
+		expected = LatestCommentsOnIndex
+	}
+
+	nodes := node.Find(".isu-comment")
+	if nodes.Length() != expected {
+		return append(errs, failure.NewError(ErrInvalidComment, fmt.Errorf("%s : comments of post %d, expected(%d) != actual(%d)", endpoint(r), post.ID, expected, nodes.Length())))
+	}
+	if expected == 0 {
+		return errs
+	}
+
+	// created_at of a comment is only known to lie between sending the request
+	// and receiving the response, so a comment is a candidate unless expected
+	// comments are surely newer than it. Comments of the same second may be
+	// displayed in any order. While some comments are uncertain, any tracked
+	// comment is a candidate.
+	earliest := make([]time.Time, 0, len(comments))
+	for _, comment := range comments {
+		from, _ := comment.CreatedAtRange()
+		earliest = append(earliest, from)
+	}
+	sort.Slice(earliest, func(i, j int) bool { return earliest[i].After(earliest[j]) })
+
+	candidates := map[string]bool{}
+	for _, comment := range append(comments, unconfirmed...) {
+		if uncertain == 0 {
+			_, to := comment.CreatedAtRange()
+			newer := sort.Search(len(earliest), func(i int) bool { return !earliest[i].After(to) })
+			if newer >= expected {
+				continue
+			}
+		}
+		if user, ok := users.Get(comment.UserID); ok {
+			candidates[user.AccountName+"\x00"+strings.TrimSpace(comment.Comment)] = true
+		}
+	}
+
+	unknown := 0
+	nodes.Each(func(_ int, s *goquery.Selection) {
+		accountName := strings.TrimSpace(s.Find(".isu-comment-account-name").Text())
+		text := strings.TrimSpace(s.Find(".isu-comment-text").Text())
+		if candidates[accountName+"\x00"+text] {
+			return
+		}
+		// in-flight comments are not tracked yet.
+		if unknown < pending {
+			unknown++
+			return
+		}
+		errs = append(errs, failure.NewError(ErrInvalidComment, fmt.Errorf("%s : unexpected comment by %s in post %d", endpoint(r), accountName, post.ID)))
+	})
+
+	return errs
+}
+
+var (
+	postLocationPattern = regexp.MustCompile(`^/posts/(\d+)$`)
+)
+
+func WithPostLocation(post *Post) ResponseValidator {
+	return func(r *http.Response) error {
+		location, err := r.Location()
+		if err != nil {
+			return failure.NewError(ErrInvalidPath, fmt.Errorf("%s : %s, %v", endpoint(r), "Location", err))
+		}
+
+		matches := postLocationPattern.FindStringSubmatch(location.Path)
+		if matches == nil {
 			return failure.NewError(
 				ErrInvalidPath,
-				fmt.Errorf("%s %s : %s, expected(%s) != actual(%s)", r.Request.Method, r.Request.URL.Path, "Location", val, r.Header.Get("Location")),
+				fmt.Errorf("%s : %s, expected(%s) != actual(%s)", endpoint(r), "Location", "/posts/:id", location.Path),
 			)
 		}
+
+		post.ID, _ = strconv.Atoi(matches[1])
+
+		return nil
+	}
+}
+
+func WithPostCreatedAt(post *Post) ResponseValidator {
+	return func(r *http.Response) error {
+		defer r.Body.Close()
+
+		doc, err := goquery.NewDocumentFromReader(r.Body)
+		if err != nil {
+			return failure.NewError(ErrInvalidResposne, fmt.Errorf("%s : %s", endpoint(r), err.Error()))
+		}
+
+		createdAtAttr, exists := doc.Find(fmt.Sprintf("#pid_%d", post.ID)).First().Attr("data-created-at")
+		if !exists {
+			return failure.NewError(ErrInvalidPost, fmt.Errorf("%s : post %d is not found", endpoint(r), post.ID))
+		}
+
+		createdAt, err := time.Parse(time.RFC3339, createdAtAttr)
+		if err != nil {
+			return failure.NewError(ErrInvalidCreatedAt, fmt.Errorf("%s : %v", endpoint(r), err))
+		}
+		post.CreatedAt = createdAt
+
 		return nil
 	}
 }
@@ -205,7 +637,7 @@ func WithAssets(ctx context.Context, ag *agent.Agent) ResponseValidator {
 		if err != nil {
 			return failure.NewError(
 				ErrInvalidAsset,
-				fmt.Errorf("%s %s : %v", r.Request.Method, r.Request.URL.Path, err),
+				fmt.Errorf("%s : %v", endpoint(r), err),
 			)
 		}
 
@@ -214,7 +646,7 @@ func WithAssets(ctx context.Context, ag *agent.Agent) ResponseValidator {
 		for uri, res := range resources {
 			path := strings.TrimPrefix(uri, ag.BaseURL.String())
 			if res.Error != nil {
-				errs = append(errs, failure.NewError(ErrInvalidAsset, fmt.Errorf("%s / %s : %v", "GET", path, res.Error)))
+				errs = append(errs, failure.NewError(ErrInvalidAsset, fmt.Errorf("%s / %s : %w", "GET", path, res.Error)))
 				continue
 			}
 
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/isucon/isucandar/failure"
+)
+
+type validationFixture struct {
+	users   *UserSet
+	posts   *PostSet
+	mary    *User
+	bob     *User
+	post2   *Post
+	post3   *Post
+	comment *Comment
+}
+
+// newValidationFixture returns the models rendered in testdata/*.html.
+func newValidationFixture() *validationFixture {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+
+	f := &validationFixture{
+		users: &UserSet{},
+		posts: &PostSet{},
+		mary:  &User{ID: 1, AccountName: "mary", CreatedAt: time.Date(2022, 3, 20, 11, 0, 0, 0, jst)},
+		bob:   &User{ID: 2, AccountName: "bob", CreatedAt: time.Date(2022, 3, 20, 11, 0, 1, 0, jst)},
+	}
+	f.post2 = &Post{ID: 2, Mime: "image/jpeg", Body: "second post", UserID: f.bob.ID, CreatedAt: time.Date(2022, 3, 20, 12, 0, 1, 0, jst)}
+	f.post3 = &Post{ID: 3, Mime: "image/png", Body: "third post", UserID: f.mary.ID, CreatedAt: time.Date(2022, 3, 20, 12, 0, 2, 0, jst)}
+	f.comment = &Comment{ID: 1, Comment: "nice picture", PostID: f.post3.ID, UserID: f.bob.ID, CreatedAt: time.Date(2022, 3, 20, 12, 0, 3, 0, jst)}
+	f.post3.AddComment(f.comment)
+
+	f.users.Add(f.mary)
+	f.users.Add(f.bob)
+	f.posts.Add(f.post2)
+	f.posts.Add(f.post3)
+
+	return f
+}
+
+func newFixtureResponse(t *testing.T, statusCode int, location string, fixture string) *http.Response {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	if location != "" {
+		recorder.Header().Set("Location", location)
+	}
+	recorder.WriteHeader(statusCode)
+
+	if fixture != "" {
+		body, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.Body.Write(body)
+	}
+
+	res := recorder.Result()
+	res.Request = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	return res
+}
+
+func TestValidators(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statusCode int
+		location   string
+		fixture    string
+		validator  func(f *validationFixture) ResponseValidator
+		code       failure.Code
+	}{
+		{
+			name:       "status code",
+			statusCode: http.StatusOK,
+			validator:  func(f *validationFixture) ResponseValidator { return WithStatusCode(http.StatusOK) },
+		},
+		{
+			name:       "unexpected status code",
+			statusCode: http.StatusInternalServerError,
+			validator:  func(f *validationFixture) ResponseValidator { return WithStatusCode(http.StatusOK) },
+			code:       ErrInvalidStatusCode,
+		},
+		{
+			name:       "included body",
+			statusCode: http.StatusOK,
+			fixture:    "login.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				return WithIncludeBody("アカウント名かパスワードが間違っています")
+			},
+		},
+		{
+			// every character appears in the body, but the substring does not.
+			name:       "not included body",
+			statusCode: http.StatusOK,
+			fixture:    "login.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithIncludeBody("submit form") },
+			code:       ErrNotFound,
+		},
+		{
+			name:       "csrf token",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithCSRFToken(f.mary) },
+		},
+		{
+			name:       "missing csrf token",
+			statusCode: http.StatusOK,
+			fixture:    "login.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithCSRFToken(f.mary) },
+			code:       ErrCSRFToken,
+		},
+		{
+			name:       "logged in user",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithLoggedInUser(f.mary) },
+		},
+		{
+			name:       "other logged in user",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithLoggedInUser(f.bob) },
+			code:       ErrSessionMismatch,
+		},
+		{
+			name:       "not logged in",
+			statusCode: http.StatusOK,
+			fixture:    "login.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithLoggedInUser(f.mary) },
+			code:       ErrSessionMismatch,
+		},
+		{
+			name:       "anonymous page",
+			statusCode: http.StatusOK,
+			fixture:    "login.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithAnonymousPage() },
+		},
+		{
+			name:       "logged in page for anonymous visitor",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithAnonymousPage() },
+			code:       ErrAnonymousPage,
+		},
+		{
+			name:       "index posts",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithIndexPosts(f.users, f.posts) },
+		},
+		{
+			name:       "index posts in wrong order",
+			statusCode: http.StatusOK,
+			fixture:    "index_wrong_order.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithIndexPosts(f.users, f.posts) },
+			code:       ErrInvalidPostOrder,
+		},
+		{
+			name:       "index posts of banned user",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				f.bob.DeleteFlag = 1
+				return WithIndexPosts(f.users, f.posts)
+			},
+			code: ErrInvalidPost,
+		},
+		{
+			name:       "index posts with wrong body",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				f.post2.Body = "edited post"
+				return WithIndexPosts(f.users, f.posts)
+			},
+			code: ErrInvalidPost,
+		},
+		{
+			name:       "index posts with unknown comment",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				f.post3.comments = nil
+				return WithIndexPosts(f.users, f.posts)
+			},
+			code: ErrInvalidComment,
+		},
+		{
+			name:       "index posts with in-flight comment",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				f.post3.comments = nil
+				f.post3.StartComment()
+				return WithIndexPosts(f.users, f.posts)
+			},
+		},
+		{
+			name:       "fresh post",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithFreshPost(f.post3) },
+		},
+		{
+			name:       "fresh post pushed out by newer posts",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				return WithFreshPost(&Post{ID: 1, CreatedAt: f.post2.CreatedAt.Add(-time.Second)})
+			},
+		},
+		{
+			name:       "stale post",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				return WithFreshPost(&Post{ID: 4, CreatedAt: f.post3.CreatedAt.Add(time.Second)})
+			},
+			code: ErrStaleContent,
+		},
+		{
+			name:       "user page",
+			statusCode: http.StatusOK,
+			fixture:    "user.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithUserPage(f.mary, f.post3) },
+		},
+		{
+			name:       "user page of other user",
+			statusCode: http.StatusOK,
+			fixture:    "user.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithUserPage(f.bob) },
+			code:       ErrInvalidUserPage,
+		},
+		{
+			name:       "user page without post",
+			statusCode: http.StatusOK,
+			fixture:    "user.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithUserPage(f.mary, f.post3, f.post2) },
+			code:       ErrInvalidUserPage,
+		},
+		{
+			name:       "post",
+			statusCode: http.StatusOK,
+			fixture:    "post.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithPost(f.post3, f.mary, f.comment) },
+		},
+		{
+			name:       "post not found",
+			statusCode: http.StatusOK,
+			fixture:    "post.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithPost(f.post2, f.bob) },
+			code:       ErrInvalidPost,
+		},
+		{
+			name:       "post of other user",
+			statusCode: http.StatusOK,
+			fixture:    "post.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithPost(f.post3, f.bob) },
+			code:       ErrInvalidPost,
+		},
+		{
+			name:       "post without comment",
+			statusCode: http.StatusOK,
+			fixture:    "post.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				return WithPost(f.post3, f.mary, &Comment{ID: 2, Comment: "lost comment", PostID: f.post3.ID, UserID: f.mary.ID})
+			},
+			code: ErrInvalidComment,
+		},
+		{
+			name:       "relative location",
+			statusCode: http.StatusFound,
+			location:   "/login",
+			validator:  func(f *validationFixture) ResponseValidator { return WithLocation("/login") },
+		},
+		{
+			name:       "absolute location",
+			statusCode: http.StatusFound,
+			location:   "http://example.com/login",
+			validator:  func(f *validationFixture) ResponseValidator { return WithLocation("/login") },
+		},
+		{
+			name:       "unexpected location",
+			statusCode: http.StatusFound,
+			location:   "/",
+			validator:  func(f *validationFixture) ResponseValidator { return WithLocation("/login") },
+			code:       ErrInvalidPath,
+		},
+		{
+			name:       "missing location",
+			statusCode: http.StatusFound,
+			validator:  func(f *validationFixture) ResponseValidator { return WithLocation("/login") },
+			code:       ErrInvalidPath,
+		},
+		{
+			name:       "post location",
+			statusCode: http.StatusFound,
+			location:   "/posts/4",
+			validator:  func(f *validationFixture) ResponseValidator { return WithPostLocation(&Post{}) },
+		},
+		{
+			name:       "unexpected post location",
+			statusCode: http.StatusFound,
+			location:   "/",
+			validator:  func(f *validationFixture) ResponseValidator { return WithPostLocation(&Post{}) },
+			code:       ErrInvalidPath,
+		},
+		{
+			name:       "post created at",
+			statusCode: http.StatusOK,
+			fixture:    "post.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithPostCreatedAt(f.post3) },
+		},
+		{
+			name:       "post created at not found",
+			statusCode: http.StatusOK,
+			fixture:    "post.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithPostCreatedAt(f.post2) },
+			code:       ErrInvalidPost,
+		},
+		{
+			name:       "initial posts",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithInitialPosts(f.posts, f.post3.ID, false) },
+		},
+		{
+			name:       "post created after the dump",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator:  func(f *validationFixture) ResponseValidator { return WithInitialPosts(f.posts, f.post2.ID, false) },
+			code:       ErrInitialData,
+		},
+		{
+			name:       "comment created after the dump",
+			statusCode: http.StatusOK,
+			fixture:    "index.html",
+			validator: func(f *validationFixture) ResponseValidator {
+				// the dump has no comment on post 3.
+				posts := &PostSet{}
+				posts.Add(f.post2)
+				posts.Add(&Post{ID: f.post3.ID, Mime: f.post3.Mime, Body: f.post3.Body, UserID: f.post3.UserID, CreatedAt: f.post3.CreatedAt})
+				return WithInitialPosts(posts, f.post3.ID, false)
+			},
+			code: ErrInitialData,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			res := newFixtureResponse(t, tc.statusCode, tc.location, tc.fixture)
+			validation := ValidateResponse(res, tc.validator(newValidationFixture()))
+
+			if tc.code == nil {
+				if !validation.IsEmpty() {
+					t.Errorf("unexpected errors: %v", validation)
+				}
+				return
+			}
+
+			if validation.IsEmpty() {
+				t.Fatalf("%s is not reported", tc.code.ErrorCode())
+			}
+			if !validation.IsOnly(tc.code) {
+				t.Errorf("only %s is expected: %v", tc.code.ErrorCode(), validation)
+			}
+		})
+	}
+}
+
+func TestValidatorsUpdateModels(t *testing.T) {
+	f := newValidationFixture()
+
+	ValidateResponse(newFixtureResponse(t, http.StatusOK, "", "index.html"), WithCSRFToken(f.mary))
+	if token := f.mary.GetCSRFToken(); token != "a1b2c3d4e5f6" {
+		t.Errorf("csrf token, expected(a1b2c3d4e5f6) != actual(%s)", token)
+	}
+
+	ValidateResponse(newFixtureResponse(t, http.StatusOK, "", "login.html"), WithCSRFToken(f.mary))
+	if token := f.mary.GetCSRFToken(); token != "" {
+		t.Errorf("csrf token must be cleared: %s", token)
+	}
+
+	post := &Post{}
+	ValidateResponse(newFixtureResponse(t, http.StatusFound, "/posts/4", ""), WithPostLocation(post))
+	if post.ID != 4 {
+		t.Errorf("post id, expected(4) != actual(%d)", post.ID)
+	}
+
+	createdAt := f.post3.CreatedAt
+	f.post3.CreatedAt = time.Time{}
+	ValidateResponse(newFixtureResponse(t, http.StatusOK, "", "post.html"), WithPostCreatedAt(f.post3))
+	if !f.post3.CreatedAt.Equal(createdAt) {
+		t.Errorf("created at, expected(%s) != actual(%s)", createdAt, f.post3.CreatedAt)
+	}
+}
+
+func TestValidateResponseSharesBody(t *testing.T) {
+	f := newValidationFixture()
+	res := newFixtureResponse(t, http.StatusOK, "", "index.html")
+
+	validation := ValidateResponse(
+		res,
+		WithIncludeBody("third post"),
+		WithCSRFToken(f.mary),
+		WithLoggedInUser(f.mary),
+		WithIndexPosts(f.users, f.posts),
+		WithFreshPost(f.post3),
+	)
+	if !validation.IsEmpty() {
+		t.Errorf("unexpected errors: %v", validation)
+	}
+
+	// the body is still readable after validation.
+	validation = ValidateResponse(res, WithIncludeBody("second post"))
+	if !validation.IsEmpty() {
+		t.Errorf("unexpected errors: %v", validation)
+	}
+}
+
+func TestValidateResponseBodyTooLarge(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	recorder.WriteHeader(http.StatusOK)
+	recorder.Body.WriteString(strings.Repeat("a", MaxResponseBodySize+1))
+
+	res := recorder.Result()
+	res.Request = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+	validation := ValidateResponse(res, WithStatusCode(http.StatusOK), WithIncludeBody("a"))
+	if validation.IsEmpty() || !validation.IsOnly(ErrBodyTooLarge) {
+		t.Errorf("only %s is expected: %v", ErrBodyTooLarge.ErrorCode(), validation)
+	}
+}
+
+func TestWithAssets(t *testing.T) {
+	testCases := []struct {
+		name    string
+		options MockOptions
+		code    failure.Code
+	}{
+		{name: "assets", options: MockOptions{}},
+		{name: "broken assets", options: MockOptions{BrokenAssets: true}, code: ErrInvalidAsset},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewMockServer(NewMockFixture(2, 2, 2), tc.options).Start(t)
+
+			option := Option{
+				TargetHost:     strings.TrimPrefix(server.URL, "http://"),
+				RequestTimeout: DefaultRequestTimeout,
+			}
+			ag, err := option.NewAgent(TimeoutDefault)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := newFixtureResponse(t, http.StatusOK, "", "index.html")
+			res.Request = httptest.NewRequest(http.MethodGet, server.URL+"/", nil)
+			validation := ValidateResponse(res, WithAssets(context.Background(), ag))
+
+			if tc.code == nil {
+				if !validation.IsEmpty() {
+					t.Errorf("unexpected errors: %v", validation)
+				}
+				return
+			}
+
+			if validation.IsEmpty() || !validation.IsOnly(tc.code) {
+				t.Errorf("only %s is expected: %v", tc.code.ErrorCode(), validation)
+			}
+		})
+	}
+}
+
+func TestValidationErrorFlattening(t *testing.T) {
+	errA := failure.NewError(ErrInvalidPost, errors.New("a"))
+	errB := failure.NewError(ErrInvalidPost, errors.New("b"))
+	errC := failure.NewError(ErrInvalidComment, errors.New("c"))
+
+	testCases := []struct {
+		name       string
+		validation ValidationError
+		all        []error
+		isEmpty    bool
+		isOnlyPost bool
+	}{
+		{
+			name:       "empty",
+			validation: ValidationError{},
+			all:        []error{},
+			isEmpty:    true,
+			isOnlyPost: true,
+		},
+		{
+			name:       "nested empty",
+			validation: ValidationError{Errors: []error{nil, ValidationError{Errors: []error{ValidationError{}}}}},
+			all:        []error{},
+			isEmpty:    true,
+			isOnlyPost: true,
+		},
+		{
+			name:       "flat",
+			validation: ValidationError{Errors: []error{errA, nil, errB}},
+			all:        []error{errA, errB},
+			isOnlyPost: true,
+		},
+		{
+			name: "nested",
+			validation: ValidationError{Errors: []error{
+				errA,
+				ValidationError{Errors: []error{ValidationError{Errors: []error{errB}}, nil}},
+				ValidationError{Errors: []error{errC}},
+			}},
+			all: []error{errA, errB, errC},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			all := tc.validation.All()
+			if len(all) != len(tc.all) {
+				t.Fatalf("flattened errors, expected(%v) != actual(%v)", tc.all, all)
+			}
+			for i := range all {
+				if all[i] != tc.all[i] {
+					t.Errorf("flattened errors[%d], expected(%v) != actual(%v)", i, tc.all[i], all[i])
+				}
+			}
+
+			if tc.validation.IsEmpty() != tc.isEmpty {
+				t.Errorf("IsEmpty, expected(%v) != actual(%v)", tc.isEmpty, tc.validation.IsEmpty())
+			}
+			if tc.validation.IsOnly(ErrInvalidPost) != tc.isOnlyPost {
+				t.Errorf("IsOnly, expected(%v) != actual(%v)", tc.isOnlyPost, tc.validation.IsOnly(ErrInvalidPost))
+			}
+		})
+	}
+}
+
+func TestValidateLatestComments(t *testing.T) {
+	users := &UserSet{}
+	bob := &User{ID: 2, AccountName: "bob"}
+	users.Add(bob)
+
+	base := time.Date(2022, 3, 20, 12, 0, 0, 0, time.UTC)
+	post := &Post{ID: 1, UserID: bob.ID}
+	comments := []*Comment{
+		{Comment: "oldest", sentAt: base.Add(-time.Second), CreatedAt: base.Add(-time.Second)},
+		{Comment: "first", sentAt: base, CreatedAt: base},
+		{Comment: "second", sentAt: base.Add(time.Second), CreatedAt: base.Add(time.Second)},
+		{Comment: "third", sentAt: base.Add(2 * time.Second), CreatedAt: base.Add(2 * time.Second)},
+		// its response took 3s, so the server may have stored it at base.
+		{Comment: "slow", sentAt: base, CreatedAt: base.Add(3 * time.Second)},
+	}
+	for _, comment := range comments {
+		comment.PostID = post.ID
+		comment.UserID = bob.ID
+		post.StartComment()
+		post.FinishComment(comment, true)
+	}
+
+	testCases := []struct {
+		name      string
+		displayed []string
+		valid     bool
+	}{
+		{name: "slow comment is the newest", displayed: []string{"second", "third", "slow"}, valid: true},
+		{name: "slow comment is the oldest", displayed: []string{"first", "second", "third"}, valid: true},
+		{name: "surely older comment", displayed: []string{"oldest", "second", "third"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			html := `<div class="isu-post"><div class="isu-post-comment-count">comments: <b>5</b></div>`
+			for _, text := range tc.displayed {
+				html += `<div class="isu-comment"><a class="isu-comment-account-name">bob</a><span class="isu-comment-text">` + text + `</span></div>`
+			}
+			html += `</div>`
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), requestStartedAtKey{}, time.Now()))
+			errs := validateLatestComments(&http.Response{Request: req}, doc.Find(".isu-post"), post, users)
+
+			if tc.valid && len(errs) > 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+			if !tc.valid && len(errs) == 0 {
+				t.Error("surely older comment is accepted")
+			}
+		})
+	}
+}